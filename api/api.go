@@ -0,0 +1,360 @@
+package api
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"Gin-ZJUST/audit"
+	"Gin-ZJUST/files"
+	"Gin-ZJUST/server"
+
+	"github.com/gin-gonic/gin"
+)
+
+// JSON 接口，与页面路由使用相同的登录与权限校验
+// 出错时统一返回 {"error": {"code": ..., "message": ...}}，列表接口统一返回 {"data": [...], "page", "per_page", "total"}
+
+//go:embed openapi.json
+var openapi_spec []byte // 接口文档（OpenAPI 3），新增或修改接口时需同步更新
+
+type api_query struct {
+	fields  string            // 查询的字段
+	tables  string            // FROM 子句
+	cond    string            // WHERE 条件，限定当前用户可查看的范围
+	order   string            // 排序字段，保证翻页时顺序稳定
+	filters map[string]string // 可用于筛选的查询参数 to 字段，值相等时保留
+}
+
+func api_list(s *server.Server, c *gin.Context, q api_query, convert func(rows []map[string]any)) error {
+	// 分页返回列表，page 从1开始，per_page 默认20、最大100；筛选、分页均在数据库中完成
+	page, err := strconv.Atoi(c.DefaultQuery("page", "1"))
+	if err != nil || page < 1 {
+		page = 1
+	}
+	per_page, err := strconv.Atoi(c.DefaultQuery("per_page", "20"))
+	if err != nil || per_page < 1 {
+		per_page = 20
+	} else if per_page > 100 {
+		per_page = 100
+	}
+	conds := []string{"(" + q.cond + ")"}
+	for param, field := range q.filters {
+		if want, ok := c.GetQuery(param); ok {
+			conds = append(conds, fmt.Sprintf("%s=%s", field, server.Join_strs([]string{want})))
+		}
+	}
+	where := strings.Join(conds, " AND ")
+	count, err := s.Query_one(fmt.Sprintf("SELECT COUNT(*) AS n FROM %s WHERE %s;", q.tables, where))
+	if err != nil {
+		return err
+	}
+	total, ok := count["n"].(int64)
+	if !ok {
+		return server.Internal(fmt.Errorf("记录数量类型有误：%T", count["n"]))
+	}
+	rows := s.Query(fmt.Sprintf("SELECT %s FROM %s WHERE %s ORDER BY %s LIMIT %d OFFSET %d;", q.fields, q.tables, where, q.order, per_page, (page-1)*per_page))
+	if convert != nil {
+		convert(rows)
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"data":     rows,
+		"page":     page,
+		"per_page": per_page,
+		"total":    total,
+	})
+	return nil
+}
+
+func api_id(c *gin.Context) (int64, error) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		return 0, server.Err_bad_request
+	}
+	return id, nil
+}
+
+func api_records(row map[string]any) {
+	// 将JSON格式的操作记录展开为数组
+	records := []map[string]any{}
+	if record_str, ok := row["record"].(string); ok {
+		json.Unmarshal([]byte(record_str), &records)
+	}
+	row["record"] = records
+}
+
+func api_item(row map[string]any) map[string]any {
+	row["type_name"] = server.Item_types[row["type"].(int64)]
+	if status, ok := row["status"].(int64); ok && status != 0 {
+		row["status_name"] = server.Item_status[status]
+	}
+	api_records(row)
+	return row
+}
+
+func api_appliance(row map[string]any) map[string]any {
+	row["status_name"] = server.Appliance_status[row["status"].(int64)]
+	api_records(row)
+	return row
+}
+
+func visible_items(account_type int64, orgID int64) string {
+	// 学校管理员、超级管理员可查看全部项目；单位、学院管理员可查看基础项目和本组织创建的项目；其余用户可查看项目目录中的项目
+	if account_type == 0 || account_type == 1 {
+		return "1=1"
+	} else if account_type == 2 || account_type == 3 {
+		return fmt.Sprintf("item.type=0 OR item.type=1 OR item.create_org=%d", orgID)
+	}
+	return server.Catalogue_items
+}
+
+func visible_appliances(userID string, account_type int64, orgID int64) string {
+	// 学生可查看本人的申请，审核管理员可查看管辖范围内学生的申请；查询时联结 user 表
+	if account_type == 5 {
+		return fmt.Sprintf("appliance.userID=user.userID AND appliance.userID=%s", server.Join_strs([]string{userID}))
+	}
+	return fmt.Sprintf("appliance.userID=user.userID AND user.account_type=5 AND %s", server.Scope_orgs(account_type, orgID))
+}
+
+func api_items(rows []map[string]any) {
+	for _, row := range rows {
+		api_item(row)
+	}
+}
+
+func api_appliances(rows []map[string]any) {
+	for _, row := range rows {
+		api_appliance(row)
+	}
+}
+
+func Register(s *server.Server) {
+	r := s.Router
+
+	r.GET("/api/openapi.json", func(c *gin.Context) {
+		c.Data(http.StatusOK, "application/json; charset=utf-8", openapi_spec)
+	})
+
+	// 按使用API令牌访问时所需的权限范围分组
+	read := r.Group("/api/v1", s.Token_scope("read"), s.Midware_Auth)
+	write := r.Group("/api/v1", s.Token_scope("write"), s.Midware_Auth)
+	auditing := r.Group("/api/v1", s.Token_scope("audit"), s.Midware_Auth)
+
+	read.GET("/me", s.Authorities(0b111111), func(c *gin.Context) {
+		userID := c.GetString("userID")
+		account_type := c.GetInt64("account_type")
+		c.JSON(http.StatusOK, gin.H{
+			"userID":            userID,
+			"account_type":      account_type,
+			"account_type_name": server.Account_types[account_type],
+			"belonging_org":     c.GetInt64("belonging_org"),
+			"authorities":       s.User_authorities(userID, account_type),
+		})
+	})
+
+	read.GET("/users", s.Authorities(0b011011), s.Permission(server.Perm_check_student_info), s.Handle(func(c *gin.Context) error {
+		account_type := c.GetInt64("account_type")
+		cond := "1=1"
+		if account_type != 0 && account_type != 1 {
+			cond = "user.account_type=5 AND " + server.Scope_orgs(account_type, c.GetInt64("belonging_org"))
+		}
+		return api_list(s, c, api_query{
+			fields:  "userID,account_type,belonging_org",
+			tables:  "user",
+			cond:    cond,
+			order:   "userID",
+			filters: map[string]string{"account_type": "account_type", "belonging_org": "belonging_org"},
+		}, nil)
+	}))
+
+	read.GET("/organizations", s.Authorities(0b000011), s.Handle(func(c *gin.Context) error {
+		return api_list(s, c, api_query{
+			fields:  "*",
+			tables:  "organization",
+			cond:    "1=1",
+			order:   "orgID",
+			filters: map[string]string{"type": "type", "higher_org": "higher_org"},
+		}, nil)
+	}))
+
+	read.GET("/organizations/:id", s.Authorities(0b000011), s.Handle(func(c *gin.Context) error {
+		orgID, err := api_id(c)
+		if err != nil {
+			return err
+		}
+		org, err := s.Query_one(fmt.Sprintf("SELECT * FROM organization WHERE orgID=%d;", orgID))
+		if err != nil {
+			return err
+		}
+		org["children"] = s.Query(fmt.Sprintf("SELECT * FROM organization WHERE higher_org=%d;", orgID))
+		c.JSON(http.StatusOK, org)
+		return nil
+	}))
+
+	read.GET("/items", s.Authorities(0b111111), s.Handle(func(c *gin.Context) error {
+		return api_list(s, c, api_query{
+			fields:  "*",
+			tables:  "item",
+			cond:    visible_items(c.GetInt64("account_type"), c.GetInt64("belonging_org")),
+			order:   "itemID",
+			filters: map[string]string{"type": "type", "status": "status", "create_org": "create_org"},
+		}, api_items)
+	}))
+
+	read.GET("/items/:id", s.Authorities(0b111111), s.Handle(func(c *gin.Context) error {
+		itemID, err := api_id(c)
+		if err != nil {
+			return err
+		}
+		item, err := s.Query_one(fmt.Sprintf("SELECT * FROM item WHERE itemID=%d AND (%s);", itemID, visible_items(c.GetInt64("account_type"), c.GetInt64("belonging_org"))))
+		if err != nil {
+			return err
+		}
+		c.JSON(http.StatusOK, api_item(item))
+		return nil
+	}))
+
+	auditing.POST("/items/:id/audit", s.Authorities(0b000011), s.Handle(func(c *gin.Context) error {
+		itemID, err := api_id(c)
+		if err != nil {
+			return err
+		}
+		req := struct {
+			Action  int64  `json:"action"`
+			Opinion string `json:"opinion"`
+		}{}
+		if err := c.ShouldBindJSON(&req); err != nil {
+			return server.Err_bad_request
+		}
+		if err := audit.Audit_activity_item(s, c.GetString("userID"), itemID, req.Action, req.Opinion); err != nil {
+			return err
+		}
+		row, err := s.Query_one(fmt.Sprintf("SELECT * FROM item WHERE itemID=%d;", itemID))
+		if err != nil {
+			return err
+		}
+		c.JSON(http.StatusOK, api_item(row))
+		return nil
+	}))
+
+	// 学生查看本人的申请；管理员与审核页面相同，还需被授予基础项目审核功能
+	audit_permission := s.Permission(server.Perm_audit_basic)
+	appliance_viewer := func(c *gin.Context) {
+		if c.GetInt64("account_type") != 5 {
+			audit_permission(c)
+		}
+	}
+
+	read.GET("/appliances", s.Authorities(0b111011), appliance_viewer, s.Handle(func(c *gin.Context) error {
+		return api_list(s, c, api_query{
+			fields:  "appliance.*",
+			tables:  "appliance,user",
+			cond:    visible_appliances(c.GetString("userID"), c.GetInt64("account_type"), c.GetInt64("belonging_org")),
+			order:   "appliance.applianceID",
+			filters: map[string]string{"status": "appliance.status", "itemID": "appliance.itemID", "userID": "appliance.userID"},
+		}, api_appliances)
+	}))
+
+	read.GET("/appliances/:id", s.Authorities(0b111011), appliance_viewer, s.Handle(func(c *gin.Context) error {
+		applianceID, err := api_id(c)
+		if err != nil {
+			return err
+		}
+		ap, err := s.Query_one(fmt.Sprintf("SELECT appliance.* FROM appliance,user WHERE appliance.applianceID=%d AND %s;", applianceID, visible_appliances(c.GetString("userID"), c.GetInt64("account_type"), c.GetInt64("belonging_org"))))
+		if err != nil {
+			return err
+		}
+		c.JSON(http.StatusOK, api_appliance(ap))
+		return nil
+	}))
+
+	write.POST("/appliances", s.Authorities(0b100000), s.Handle(func(c *gin.Context) error {
+		// 申请项目目录中的项目，附件需通过页面上传
+		req := struct {
+			ItemID      int64  `json:"itemID"`
+			Description string `json:"description"`
+		}{}
+		if err := c.ShouldBindJSON(&req); err != nil {
+			return server.Err_bad_request
+		}
+		if len(s.Query(fmt.Sprintf("SELECT * FROM item WHERE itemID=%d AND %s;", req.ItemID, server.Catalogue_items))) == 0 {
+			return server.Err_not_found
+		} else if !s.Item_open(req.ItemID) {
+			return server.Err_item_closed
+		}
+		res, err := s.DB.Exec("INSERT INTO appliance VALUES(NULL,?,?,0,0,\"[]\",?,?);", req.ItemID, c.GetString("userID"), time.Now().Unix(), req.Description)
+		if err != nil {
+			return err
+		}
+		s.Metrics.Appliance_created("api")
+		applianceID, _ := res.LastInsertId()
+		row, err := s.Query_one(fmt.Sprintf("SELECT * FROM appliance WHERE applianceID=%d;", applianceID))
+		if err != nil {
+			return err
+		}
+		c.JSON(http.StatusCreated, api_appliance(row))
+		return nil
+	}))
+
+	write.DELETE("/appliances/:id", s.Authorities(0b100000), s.Handle(func(c *gin.Context) error {
+		applianceID, err := api_id(c)
+		if err != nil {
+			return err
+		}
+		res, err := s.DB.Exec("DELETE FROM appliance WHERE applianceID=? AND userID=?;", applianceID, c.GetString("userID"))
+		if err != nil {
+			return err
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			return server.Err_not_found
+		}
+		files.Remove(s, files.Owner_appliance, []int64{applianceID})
+		c.Status(http.StatusNoContent)
+		return nil
+	}))
+
+	auditing.POST("/appliances/:id/audit", s.Authorities(0b011011), s.Permission(server.Perm_audit_basic), s.Handle(func(c *gin.Context) error {
+		applianceID, err := api_id(c)
+		if err != nil {
+			return err
+		}
+		req := struct {
+			Pass    bool     `json:"pass"`
+			Opinion string   `json:"opinion"`
+			Score   *float64 `json:"score"` // 学院审核通过时必填，须在项目的分值范围内
+		}{}
+		if err := c.ShouldBindJSON(&req); err != nil {
+			return server.Err_bad_request
+		}
+		account_type := c.GetInt64("account_type")
+		if err := audit.Audit_appliance(s, c.GetString("userID"), account_type, c.GetInt64("belonging_org"), applianceID, req.Pass, req.Opinion, req.Score); err != nil {
+			return err
+		}
+		row, err := s.Query_one(fmt.Sprintf("SELECT * FROM appliance WHERE applianceID=%d;", applianceID))
+		if err != nil {
+			return err
+		}
+		c.JSON(http.StatusOK, api_appliance(row))
+		return nil
+	}))
+
+	auditing.GET("/audits/pending", s.Authorities(0b011011), s.Permission(server.Perm_audit_basic), s.Handle(func(c *gin.Context) error {
+		return api_list(s, c, api_query{
+			fields:  audit.Pending_fields,
+			tables:  audit.Pending_tables,
+			cond:    audit.Pending_cond(c.GetInt64("account_type"), c.GetInt64("belonging_org")),
+			order:   "ap.applianceID",
+			filters: map[string]string{"userID": "ap.userID", "type": "item.type"},
+		}, func(rows []map[string]any) {
+			audit.Mark_quarantined(s, rows)
+			for _, ap := range rows {
+				ap["status_name"] = server.Appliance_status[ap["status"].(int64)]
+				ap["type_name"] = server.Item_types[ap["type"].(int64)]
+			}
+		})
+	}))
+}
@@ -0,0 +1,226 @@
+package api_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"Gin-ZJUST/apptest"
+	"Gin-ZJUST/server"
+)
+
+type list struct {
+	Data    []map[string]any `json:"data"`
+	Page    int              `json:"page"`
+	PerPage int              `json:"per_page"`
+	Total   int              `json:"total"`
+	Error   struct {
+		Code    string `json:"code"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+func api_get(t *testing.T, c *apptest.Client, path string) (int, list) {
+	// 请求JSON接口，列表和错误对象解析到同一结构中
+	t.Helper()
+	w := c.Get(path)
+	res := list{}
+	if err := json.Unmarshal(w.Body.Bytes(), &res); err != nil {
+		t.Fatalf("%s 返回的不是JSON：%d %s", path, w.Code, w.Body.String())
+	}
+	return w.Code, res
+}
+
+func api_post(t *testing.T, c *apptest.Client, path string, body string) (int, list) {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := c.Do(req)
+	res := list{}
+	if err := json.Unmarshal(w.Body.Bytes(), &res); err != nil {
+		t.Fatalf("%s 返回的不是JSON：%d %s", path, w.Code, w.Body.String())
+	}
+	return w.Code, res
+}
+
+func add_appliances(t *testing.T, s *server.Server, userID string, n int) {
+	for i := 0; i < n; i++ {
+		if !s.Exec(fmt.Sprintf("INSERT INTO appliance VALUES(NULL,1,'%s',0,0,'[]',%d,'申请%d');", userID, time.Now().Unix(), i)) {
+			t.Fatal("写入申请失败")
+		}
+	}
+}
+
+func TestAPIPagination(t *testing.T) {
+	s := apptest.New_server(t)
+	add_appliances(t, s, "stuA", 25)
+	stu := apptest.Login(t, s, "stuA")
+
+	// page 从1开始，per_page 默认20、最大100，不合法时使用默认值
+	for _, tc := range []struct {
+		query    string
+		page     int
+		per_page int
+		n        int
+	}{
+		{"", 1, 20, 20},
+		{"?page=2", 2, 20, 5},
+		{"?page=3", 3, 20, 0},
+		{"?page=2&per_page=10", 2, 10, 10},
+		{"?per_page=500", 1, 100, 25},
+		{"?page=0&per_page=abc", 1, 20, 20},
+	} {
+		code, res := api_get(t, stu, "/api/v1/appliances"+tc.query)
+		if code != http.StatusOK || res.Page != tc.page || res.PerPage != tc.per_page || len(res.Data) != tc.n || res.Total != 25 {
+			t.Fatalf("%s 分页有误：%d page=%d per_page=%d len=%d total=%d", tc.query, code, res.Page, res.PerPage, len(res.Data), res.Total)
+		}
+	}
+	_, first := api_get(t, stu, "/api/v1/appliances?per_page=5")
+	_, second := api_get(t, stu, "/api/v1/appliances?per_page=5&page=2")
+	if first.Data[0]["applianceID"] == second.Data[0]["applianceID"] {
+		t.Fatal("不同页返回了相同的记录")
+	}
+}
+
+func TestAPIVisibilityAndFilters(t *testing.T) {
+	s := apptest.New_server(t)
+	add_appliances(t, s, "stuA", 3)
+	add_appliances(t, s, "stuB", 2)
+	s.Exec("UPDATE appliance SET status=1 WHERE applianceID=1;")
+
+	// 学生只能查看本人的申请，审核管理员只能查看管辖范围内学生的申请
+	for userID, want := range map[string]int{"stuA": 3, "stuB": 2, "branchA": 3, "branchB": 2, "collegeA": 3, "collegeB": 2, "school": 5, "root": 5} {
+		if code, res := api_get(t, apptest.Login(t, s, userID), "/api/v1/appliances"); code != http.StatusOK || res.Total != want {
+			t.Fatalf("%s 可查看的申请数有误：%d %d", userID, code, res.Total)
+		}
+	}
+	root := apptest.Login(t, s, "root")
+	for query, want := range map[string]int{"?userID=stuB": 2, "?status=1": 1, "?status=0&userID=stuA": 2, "?itemID=2": 0} {
+		if _, res := api_get(t, root, "/api/v1/appliances"+query); res.Total != want {
+			t.Fatalf("%s 筛选结果有误：%d", query, res.Total)
+		}
+	}
+	stuB := apptest.Login(t, s, "stuB")
+	if _, res := api_get(t, stuB, "/api/v1/appliances?userID=stuA"); res.Total != 0 {
+		t.Fatal("学生不应能筛选出其他学生的申请")
+	}
+	if code, res := api_get(t, stuB, "/api/v1/appliances/1"); code != http.StatusNotFound || res.Error.Code != "not_found" || res.Error.Message != "记录不存在" {
+		t.Fatalf("查看其他学生的申请应返回 not_found：%d %v", code, res.Error)
+	}
+	if code, res := api_get(t, stuB, "/api/v1/appliances/4"); code != http.StatusOK || res.Error.Code != "" {
+		t.Fatalf("学生应能查看本人的申请：%d %v", code, res.Error)
+	}
+
+	// 学生信息：团支部、学院管理员只能看到管辖范围内的学生，学校管理员可看到全部账号
+	if _, res := api_get(t, apptest.Login(t, s, "branchA"), "/api/v1/users"); res.Total != 1 || res.Data[0]["userID"] != "stuA" {
+		t.Fatalf("团支部管理员可查看的学生有误：%v", res.Data)
+	}
+	if _, res := api_get(t, apptest.Login(t, s, "school"), "/api/v1/users?account_type=5"); res.Total != 2 {
+		t.Fatalf("按账号类型筛选有误：%d", res.Total)
+	}
+
+	// 组织：仅学校管理员、超级管理员可查看
+	if _, res := api_get(t, root, "/api/v1/organizations?higher_org=1"); res.Total != 3 {
+		t.Fatalf("按上级组织筛选有误：%d", res.Total)
+	}
+	if code, res := api_get(t, apptest.Login(t, s, "collegeA"), "/api/v1/organizations"); code != http.StatusForbidden || res.Error.Code != "forbidden" {
+		t.Fatalf("学院管理员不应能查看组织列表：%d %v", code, res.Error)
+	}
+
+	// 项目：学生只能查看项目目录中的项目
+	s.Exec("INSERT INTO item VALUES(2,2,1,'待审核的讲座',1,2,3,'讲座',0,'[]');")
+	if _, res := api_get(t, stuB, "/api/v1/items"); res.Total != 1 {
+		t.Fatalf("学生可查看的项目数有误：%d", res.Total)
+	}
+	if code, _ := api_get(t, stuB, "/api/v1/items/2"); code != http.StatusNotFound {
+		t.Fatalf("学生不应能查看未通过审核的项目：%d", code)
+	}
+	if _, res := api_get(t, root, "/api/v1/items?type=2"); res.Total != 1 || res.Data[0]["status_name"] != server.Item_status[1] {
+		t.Fatalf("按类型筛选项目有误：%v", res.Data)
+	}
+}
+
+func TestAPIErrors(t *testing.T) {
+	// 出错时统一返回 {"error": {"code", "message"}}
+	s := apptest.New_server(t)
+	stu := apptest.Login(t, s, "stuA")
+	for _, tc := range []struct {
+		c    *apptest.Client
+		path string
+		code int
+		err  string
+	}{
+		{apptest.Anon(t, s), "/api/v1/me", http.StatusUnauthorized, "unauthorized"},
+		{stu, "/api/v1/appliances/abc", http.StatusBadRequest, "bad_request"},
+		{stu, "/api/v1/appliances/99", http.StatusNotFound, "not_found"},
+		{stu, "/api/v1/users", http.StatusForbidden, "forbidden"},
+		{apptest.Login(t, s, "unit"), "/api/v1/appliances", http.StatusForbidden, "forbidden"},
+	} {
+		code, res := api_get(t, tc.c, tc.path)
+		if code != tc.code || res.Error.Code != tc.err || res.Error.Message == "" {
+			t.Fatalf("%s 应返回 %d %s：%d %v", tc.path, tc.code, tc.err, code, res.Error)
+		}
+	}
+}
+
+func TestAPIAppliancesNeedAuditPermission(t *testing.T) {
+	// 受委派的管理员与审核页面相同，未被授予基础项目审核功能时不能查看申请
+	s := apptest.New_server(t, func(c *server.Config) { c.DefaultPasswd = "pw" })
+	add_appliances(t, s, "stuA", 1)
+	college := apptest.Login(t, s, "collegeA")
+	apptest.Expect_body(t, college.Post("/invite_admin", url.Values{"name": {"importer"}, "permission": {fmt.Sprint(server.Perm_import_new_student)}}), "添加成功！")
+	apptest.Expect_body(t, college.Post("/invite_admin", url.Values{"name": {"auditor"}, "permission": {fmt.Sprint(server.Perm_audit_basic)}}), "添加成功！")
+
+	importer := apptest.Login(t, s, "importer")
+	apptest.Expect_body(t, importer.Get("/audit_basic.html"), "权限不足！")
+	for _, path := range []string{"/api/v1/appliances", "/api/v1/appliances/1"} {
+		if code, res := api_get(t, importer, path); code != http.StatusForbidden || res.Error.Code != "forbidden" {
+			t.Fatalf("未被授予审核功能的管理员不应能访问 %s：%d %v", path, code, res.Error)
+		}
+	}
+	auditor := apptest.Login(t, s, "auditor")
+	if code, res := api_get(t, auditor, "/api/v1/appliances"); code != http.StatusOK || res.Total != 1 {
+		t.Fatalf("被授予审核功能的管理员应能查看申请：%d %d", code, res.Total)
+	}
+	if code, _ := api_get(t, auditor, "/api/v1/appliances/1"); code != http.StatusOK {
+		t.Fatalf("被授予审核功能的管理员应能查看申请详情：%d", code)
+	}
+	if code, _ := api_get(t, apptest.Login(t, s, "stuA"), "/api/v1/appliances/1"); code != http.StatusOK {
+		t.Fatalf("学生应能查看本人的申请：%d", code)
+	}
+}
+
+func TestAPIAuditScore(t *testing.T) {
+	// 学院审核通过时须给出项目分值范围（志愿服务为 1-4）内的记点，不通过时不需要
+	s := apptest.New_server(t)
+	add_appliances(t, s, "stuA", 2)
+	s.Exec("UPDATE appliance SET status=1;")
+	college := apptest.Login(t, s, "collegeA")
+	for _, body := range []string{`{"pass":true}`, `{"pass":true,"score":5}`, `{"pass":true,"score":0.5}`} {
+		if code, res := api_post(t, college, "/api/v1/appliances/1/audit", body); code != http.StatusBadRequest || res.Error.Code != "bad_request" {
+			t.Fatalf("%s 应返回 400：%d %v", body, code, res.Error)
+		}
+	}
+	if apptest.Status_of(s, "appliance", 1) != 1 {
+		t.Fatal("记点有误时不应改变申请状态")
+	}
+	if code, _ := api_post(t, college, "/api/v1/appliances/1/audit", `{"pass":true,"score":2.5}`); code != http.StatusOK {
+		t.Fatalf("审核通过失败：%d", code)
+	}
+	if code, _ := api_post(t, college, "/api/v1/appliances/2/audit", `{"pass":false,"opinion":"材料不全"}`); code != http.StatusOK {
+		t.Fatalf("审核不通过失败：%d", code)
+	}
+	for id, want := range map[int64]float64{1: 2.5, 2: 0} {
+		if score := s.Query(fmt.Sprintf("SELECT score FROM appliance WHERE applianceID=%d;", id))[0]["score"]; score != want {
+			t.Fatalf("申请 %d 的记点为 %v，应为 %v", id, score, want)
+		}
+	}
+	if apptest.Status_of(s, "appliance", 1) != 3 || apptest.Status_of(s, "appliance", 2) != 4 {
+		t.Fatal("学院审核后的状态有误")
+	}
+}
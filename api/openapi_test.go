@@ -0,0 +1,54 @@
+package api
+
+import (
+	"encoding/json"
+	"regexp"
+	"strings"
+	"testing"
+
+	"Gin-ZJUST/server"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestOpenAPICoversRoutes(t *testing.T) {
+	// 每个注册的 /api/v1 接口都必须在 openapi.json 中有对应的路径和方法
+	spec := struct {
+		Servers []struct {
+			URL string `json:"url"`
+		} `json:"servers"`
+		Paths map[string]map[string]any `json:"paths"`
+	}{}
+	if err := json.Unmarshal(openapi_spec, &spec); err != nil {
+		t.Fatalf("openapi.json 格式有误：%v", err)
+	}
+	if len(spec.Servers) == 0 {
+		t.Fatal("openapi.json 缺少 servers")
+	}
+	prefix := spec.Servers[0].URL
+
+	gin.SetMode(gin.TestMode)
+	s := &server.Server{Router: gin.New()}
+	Register(s)
+	r := s.Router
+	param := regexp.MustCompile(`:(\w+)`)
+	documented := map[string]bool{}
+	for _, route := range r.Routes() {
+		if !strings.HasPrefix(route.Path, prefix+"/") {
+			continue
+		}
+		path := param.ReplaceAllString(strings.TrimPrefix(route.Path, prefix), "{$1}")
+		method := strings.ToLower(route.Method)
+		if _, ok := spec.Paths[path][method]; !ok {
+			t.Errorf("接口 %s %s 未写入 openapi.json", route.Method, route.Path)
+		}
+		documented[method+" "+path] = true
+	}
+	for path, methods := range spec.Paths {
+		for method := range methods {
+			if !documented[method+" "+path] {
+				t.Errorf("openapi.json 中的 %s %s 没有对应的接口", strings.ToUpper(method), path)
+			}
+		}
+	}
+}
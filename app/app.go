@@ -0,0 +1,32 @@
+package app
+
+import (
+	"Gin-ZJUST/api"
+	"Gin-ZJUST/appliance"
+	"Gin-ZJUST/audit"
+	"Gin-ZJUST/auth"
+	"Gin-ZJUST/files"
+	"Gin-ZJUST/health"
+	"Gin-ZJUST/item"
+	"Gin-ZJUST/metrics"
+	"Gin-ZJUST/org"
+	"Gin-ZJUST/server"
+)
+
+func New(c server.Config) (*server.Server, error) {
+	// 创建服务并注册全部路由；测试时可使用 :memory: 数据库
+	s, err := server.New(c)
+	if err != nil {
+		return nil, err
+	}
+	auth.Register(s)
+	org.Register(s)
+	item.Register(s)
+	appliance.Register(s)
+	files.Register(s)
+	audit.Register(s)
+	api.Register(s)
+	health.Register(s)
+	metrics.Register(s)
+	return s, nil
+}
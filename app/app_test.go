@@ -0,0 +1,153 @@
+package app
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+
+	"Gin-ZJUST/server"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestNewInMemory(t *testing.T) {
+	// 使用内存数据库创建服务，数据表和附件目录应自动创建，登录后可访问个人中心
+	gin.SetMode(gin.TestMode)
+	c := server.Default_config()
+	c.DB = ":memory:"
+	c.Templates = "../root/*"
+	c.Upload = t.TempDir() + "/upload/"
+	s, err := New(c)
+	if err != nil {
+		t.Fatalf("创建服务失败：%v", err)
+	}
+	defer s.DB.Close()
+	if info, err := os.Stat(c.Upload); err != nil || !info.IsDir() {
+		t.Fatalf("创建服务时应创建附件目录：%v", err)
+	}
+	if !s.Exec("INSERT INTO organization VALUES(1,'学校',0,NULL);") || !s.Exec("INSERT INTO user VALUES('admin','pw',0,1);") {
+		t.Fatal("写入数据失败")
+	}
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/login", strings.NewReader(url.Values{"login": {"admin"}, "pass": {"pw"}}.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	s.Router.ServeHTTP(w, req)
+	if w.Code != http.StatusTemporaryRedirect {
+		t.Fatalf("登录返回 %d", w.Code)
+	}
+	cookies := w.Result().Cookies()
+	if len(cookies) == 0 || cookies[0].Name != "SessionID" {
+		t.Fatal("登录后未下发SessionID")
+	}
+
+	w = httptest.NewRecorder()
+	req = httptest.NewRequest(http.MethodGet, "/home.html", nil)
+	req.AddCookie(cookies[0])
+	s.Router.ServeHTTP(w, req)
+	if !strings.Contains(w.Body.String(), "Welcome, admin") {
+		t.Fatalf("个人中心页面有误：%s", w.Body.String())
+	}
+}
+
+func TestHealthAndReadiness(t *testing.T) {
+	// 存活、就绪检查无需登录；附件目录不可用时就绪检查失败
+	gin.SetMode(gin.TestMode)
+	c := server.Default_config()
+	c.DB = ":memory:"
+	c.Templates = "../root/*"
+	c.Upload = t.TempDir() + "/upload"
+	if err := os.MkdirAll(c.Upload, os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	s, err := New(c)
+	if err != nil {
+		t.Fatalf("创建服务失败：%v", err)
+	}
+	defer s.DB.Close()
+	get := func(path string) int {
+		w := httptest.NewRecorder()
+		s.Router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		return w.Code
+	}
+	if code := get("/healthz"); code != http.StatusOK {
+		t.Fatalf("/healthz 返回 %d", code)
+	}
+	if code := get("/readyz"); code != http.StatusOK {
+		t.Fatalf("/readyz 返回 %d", code)
+	}
+	os.RemoveAll(c.Upload)
+	if code := get("/readyz"); code != http.StatusServiceUnavailable {
+		t.Fatalf("附件目录不存在时 /readyz 返回 %d", code)
+	}
+	s.DB.Close()
+	if code := get("/healthz"); code != http.StatusOK {
+		t.Fatalf("/healthz 返回 %d", code)
+	}
+}
+
+func TestRequestLog(t *testing.T) {
+	// 访问日志附带请求ID与当前用户，不记录查询参数和SQL中的用户数据
+	gin.SetMode(gin.TestMode)
+	c := server.Default_config()
+	c.DB = ":memory:"
+	c.Templates = "../root/*"
+	c.Upload = t.TempDir()
+	s, err := New(c)
+	if err != nil {
+		t.Fatalf("创建服务失败：%v", err)
+	}
+	defer s.DB.Close()
+	buf := &bytes.Buffer{}
+	s.Log = server.New_logger(buf)
+	s.Exec("INSERT INTO organization VALUES(1,'学校',0,NULL);")
+	s.Exec("INSERT INTO user VALUES('admin','pw',0,1);")
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/login", strings.NewReader(url.Values{"login": {"admin"}, "pass": {"pw"}}.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	s.Router.ServeHTTP(w, req)
+	cookie := w.Result().Cookies()[0]
+
+	buf.Reset()
+	w = httptest.NewRecorder()
+	req = httptest.NewRequest(http.MethodGet, "/home.html?secret=abc", nil)
+	req.Header.Set("X-Request-ID", "req-1")
+	req.AddCookie(cookie)
+	s.Router.ServeHTTP(w, req)
+	if w.Header().Get("X-Request-ID") != "req-1" {
+		t.Fatalf("响应未返回请求ID：%q", w.Header().Get("X-Request-ID"))
+	}
+	entry := map[string]any{}
+	if err := json.Unmarshal(buf.Bytes(), &entry); err != nil {
+		t.Fatalf("日志不是JSON：%s", buf.String())
+	}
+	if entry["request_id"] != "req-1" || entry["userID"] != "admin" || entry["account_type"] != float64(0) || entry["path"] != "/home.html" {
+		t.Fatalf("访问日志有误：%s", buf.String())
+	}
+	if strings.Contains(buf.String(), "secret") {
+		t.Fatalf("日志中出现了查询参数：%s", buf.String())
+	}
+
+	buf.Reset()
+	s.Query("SELECT * FROM user WHERE userID=\"a\"b\";")
+	if !strings.Contains(buf.String(), "数据库查询失败") || strings.Contains(buf.String(), "userID") {
+		t.Fatalf("数据库错误日志有误：%s", buf.String())
+	}
+
+	// 处理请求时的数据库错误附带请求ID与当前用户
+	buf.Reset()
+	ctx, _ := gin.CreateTestContext(httptest.NewRecorder())
+	ctx.Set("request_id", "req-2")
+	ctx.Set("userID", "admin")
+	s.Log_db_error(ctx, "添加项目失败", "INSERT INTO item VALUES(\"secret\");", os.ErrInvalid)
+	entry = map[string]any{}
+	if err := json.Unmarshal(buf.Bytes(), &entry); err != nil || entry["request_id"] != "req-2" || entry["userID"] != "admin" || entry["op"] != "INSERT" || strings.Contains(buf.String(), "secret") {
+		t.Fatalf("数据库错误日志有误：%s", buf.String())
+	}
+}
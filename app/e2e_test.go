@@ -0,0 +1,63 @@
+package app_test
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"Gin-ZJUST/apptest"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestErrorHandling(t *testing.T) {
+	s := apptest.New_server(t)
+	s.Router.GET("/panic", func(c *gin.Context) { panic("测试") })
+	s.Router.GET("/api/v1/panic", func(c *gin.Context) { panic("测试") })
+	anon := apptest.Anon(t, s)
+
+	// panic 时返回错误页或JSON错误对象，服务继续运行
+	w := anon.Get("/panic")
+	if w.Code != http.StatusInternalServerError || !strings.Contains(w.Body.String(), w.Header().Get("X-Request-ID")) {
+		t.Fatalf("错误页有误：%d %s", w.Code, w.Body.String())
+	}
+	apptest.Expect_body(t, w, "服务器内部错误")
+	w = anon.Get("/api/v1/panic")
+	apptest.Expect_body(t, w, `"code":"internal"`)
+
+	// 参数有误、记录不存在时返回提示而不是panic
+	stu := apptest.Login(t, s, "stuA")
+	college := apptest.Login(t, s, "collegeA")
+	school := apptest.Login(t, s, "school")
+	cases := []struct {
+		w    *httptest.ResponseRecorder
+		code int
+	}{
+		{stu.Get("/appliance_detail?applianceID=abc"), http.StatusBadRequest},
+		{stu.Upload("/apply_item?ID=99", url.Values{}, "a.txt", "a"), http.StatusNotFound},
+		{college.Get("/added_item_detail?itemID=99"), http.StatusNotFound},
+		{college.Post("/import_student_list?itemID=99", url.Values{"list": {`[{"ID":1}]`}}), http.StatusNotFound},
+		{school.Get("/audit_added_detail?itemID=99"), http.StatusNotFound},
+		{school.Post("/audit_added_item?itemID=abc", url.Values{"action": {"4"}}), http.StatusBadRequest},
+		{school.Get("/get_file?path=upload"), http.StatusNotFound},
+		{school.Post("/create_new_organization", url.Values{"name": {"新组织"}, "type": {"x"}}), http.StatusBadRequest},
+	}
+	for i, tc := range cases {
+		if tc.w.Code != tc.code {
+			t.Errorf("第 %d 个请求返回 %d，应为 %d：%s", i, tc.w.Code, tc.code, tc.w.Body.String())
+		}
+	}
+
+	// 导入名单中格式有误的条目计为导入失败
+	apptest.Expect_body(t, college.Upload("/add_activity_item", url.Values{"name": {"学院讲座"}, "type": {"2"}}, "a.txt", "a"), "添加成功！")
+	itemID := s.Query("SELECT itemID FROM item WHERE name='学院讲座';")[0]["itemID"].(int64)
+	w = college.Post(fmt.Sprintf("/import_student_list?itemID=%d", itemID), url.Values{"list": {`[{"ID":1,"score":1},{"ID":"stuA"},{"ID":"stuA","score":1}]`}})
+	apptest.Expect_body(t, w, "共导入 3 条，其中导入失败 2 条。")
+
+	// 登录期间账号被删除
+	s.Exec("DELETE FROM user WHERE userID='stuA';")
+	apptest.Expect_body(t, stu.Get("/check_record.html"), "账号不存在")
+}
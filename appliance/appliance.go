@@ -0,0 +1,185 @@
+package appliance
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"Gin-ZJUST/files"
+	"Gin-ZJUST/server"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 学生申请基础项目、查看和撤回本人的申请
+func Register(s *server.Server) {
+	r := s.Router
+
+	r.POST("/apply_item", s.Midware_Auth, s.Authorities(0b100000), files.Limit(s), s.Handle(func(c *gin.Context) error {
+		itemID, err := strconv.ParseInt(c.Query("ID"), 10, 64)
+		if err != nil {
+			return server.Err_bad_request
+		}
+		// 只能申请项目目录中的项目
+		item, err := s.Query_one(fmt.Sprintf("SELECT * from item WHERE itemID=%d AND %s", itemID, server.Catalogue_items))
+		if err != nil {
+			return err
+		}
+		userID := c.GetString("userID")
+		description := c.PostForm("description")
+		cur_time := time.Now().Unix()
+		sql := fmt.Sprintf("SELECT * FROM appliance WHERE userID=\"%s\" AND time_unix=%d;", userID, cur_time)
+		msg := ""
+		open := s.Item_open(itemID)
+		if !open {
+			msg = server.Err_item_closed.Msg + "！"
+		} else if len(s.Query(sql)) > 0 {
+			msg = "操作过于频繁，请稍候再试！"
+		} else {
+			sql = fmt.Sprintf("INSERT INTO appliance VALUES(NULL,%d,\"%s\",0,0,\"[]\",%d,\"%s\");", itemID, userID, cur_time, description)
+			res, err := s.DB.Exec(sql)
+			if err != nil {
+				s.Log_db_error(c, "提交申请失败", sql, err)
+				msg = "申请失败"
+			} else {
+				applianceID, _ := res.LastInsertId()
+				quarantined, err := files.Save(s, c, files.Owner_appliance, applianceID)
+				if err != nil {
+					// 附件不合要求时撤回申请
+					s.Exec(fmt.Sprintf("DELETE FROM appliance WHERE applianceID=%d;", applianceID))
+					if server.As_error(err).Status >= http.StatusInternalServerError {
+						return err
+					}
+					msg = "申请失败：" + err.Error()
+				} else {
+					s.Metrics.Appliance_created("apply")
+					msg = "申请成功！" + files.Quarantine_msg(quarantined)
+				}
+			}
+		}
+		item["create_org"] = s.Org_name(item["create_org"].(int64))
+		item["type"] = server.Item_types[item["type"].(int64)]
+		c.HTML(http.StatusOK, "item_info.html", gin.H{
+			"msg":  msg,
+			"item": item,
+			"open": open,
+		})
+		return nil
+	}))
+
+	r.GET("/check_record.html", s.Midware_Auth, s.Authorities(0b100000), func(c *gin.Context) {
+		userID := c.GetString("userID")
+		sql := fmt.Sprintf("SELECT appliance.applianceID AS applianceID,item.name AS name,item.type AS type,appliance.score AS score,appliance.status AS status,appliance.record AS record,appliance.time_unix AS time_unix FROM appliance,item WHERE appliance.userID=\"%s\" AND appliance.itemID=item.itemID;", userID)
+		appliances := s.Query(sql)
+		var sum2, sum3 float64
+		for _, appliance := range appliances {
+			if appliance["status"].(int64) == 5 {
+				if appliance["type"].(int64)%2 == 0 {
+					sum2 += appliance["score"].(float64)
+				} else {
+					sum3 += appliance["score"].(float64)
+				}
+			}
+			appliance["type"] = server.Item_types[appliance["type"].(int64)]
+			appliance["status"] = server.Appliance_status[appliance["status"].(int64)]
+
+		}
+		c.HTML(http.StatusOK, "check_record.html", gin.H{
+			"msg":        "",
+			"appliances": appliances,
+			"sum2":       sum2,
+			"sum3":       sum3,
+		})
+	})
+
+	r.GET("/appliance_detail", s.Midware_Auth, s.Authorities(0b100000), s.Handle(func(c *gin.Context) error {
+		userID := c.GetString("userID")
+		applianceID, err := strconv.ParseInt(c.Query("applianceID"), 10, 64)
+		if err != nil {
+			return server.Err_bad_request
+		}
+		sql := fmt.Sprintf("SELECT * FROM appliance WHERE applianceID=%d", applianceID)
+		appliance := s.Query(sql)
+		msg := ""
+		if len(appliance) == 0 {
+			msg = "项目不存在！"
+			c.HTML(http.StatusOK, "appliance_detail.html", gin.H{
+				"msg": msg,
+			})
+		} else if appliance[0]["userID"].(string) != userID {
+			msg = "非本人项目！"
+			c.HTML(http.StatusOK, "appliance_detail.html", gin.H{
+				"msg": msg,
+			})
+		} else {
+			appliance[0]["status"] = server.Appliance_status[appliance[0]["status"].(int64)]
+			itemID := appliance[0]["itemID"].(int64)
+			item, err := s.Query_one(fmt.Sprintf("SELECT * FROM item WHERE itemID=%d", itemID))
+			if err != nil {
+				return err
+			}
+			records_json := appliance[0]["record"].(string)
+			records := []map[string]any{}
+			json.Unmarshal([]byte(records_json), &records)
+			paths := files.List(s, files.Owner_appliance, applianceID)
+
+			c.HTML(http.StatusOK, "appliance_detail.html", gin.H{
+				"msg":       msg,
+				"item":      item,
+				"appliance": appliance[0],
+				"records":   records,
+				"paths":     paths,
+			})
+		}
+		return nil
+	}))
+
+	r.GET("/delete_appliance", s.Midware_Auth, s.Authorities(0b100000), s.Handle(func(c *gin.Context) error {
+		userID := c.GetString("userID")
+		applianceID, err := strconv.ParseInt(c.Query("applianceID"), 10, 64)
+		if err != nil {
+			return server.Err_bad_request
+		}
+		sql := fmt.Sprintf("SELECT * FROM appliance WHERE applianceID=%d", applianceID)
+		appliance := s.Query(sql)
+		msg := ""
+		if len(appliance) == 0 {
+			msg = "项目不存在！"
+		} else if appliance[0]["userID"].(string) != userID {
+			msg = "非本人项目！"
+		} else {
+			sql = fmt.Sprintf("DELETE FROM appliance WHERE applianceID=%d", applianceID)
+			ok := s.Exec(sql)
+			if ok {
+				msg = "删除成功！"
+				// 同时删除硬盘中存放的附件
+				files.Remove(s, files.Owner_appliance, []int64{applianceID})
+			} else {
+				msg = "删除失败！"
+			}
+		}
+
+		sql = fmt.Sprintf("SELECT appliance.applianceID AS applianceID,item.name AS name,item.type AS type,appliance.score AS score,appliance.status AS status,appliance.record AS record,appliance.time_unix AS time_unix FROM appliance,item WHERE appliance.userID=\"%s\" AND appliance.itemID=item.itemID;", userID)
+		appliances := s.Query(sql)
+		var sum2, sum3 float64
+		for _, appliance := range appliances {
+			if appliance["type"].(int64)%2 == 0 {
+				sum2 += appliance["score"].(float64)
+			} else {
+				sum3 += appliance["score"].(float64)
+			}
+			appliance["type"] = server.Item_types[appliance["type"].(int64)]
+			appliance["status"] = server.Appliance_status[appliance["status"].(int64)]
+
+		}
+		c.HTML(http.StatusOK, "check_record.html", gin.H{
+			"msg":        msg,
+			"appliances": appliances,
+			"sum2":       sum2,
+			"sum3":       sum3,
+		})
+		return nil
+	}))
+}
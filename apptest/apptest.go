@@ -0,0 +1,168 @@
+package apptest
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"Gin-ZJUST/app"
+	"Gin-ZJUST/server"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 各功能包测试共用的测试服务、测试数据与模拟浏览器的客户端，仅供 _test.go 使用
+
+// 测试数据：学校(1) 下设单位(2)、学院A(3)、学院B(5)，学院A下设团支部A(4)，学院B下设团支部B(6)
+// 每个账号的密码均为 pw
+var Fixtures = []string{
+	"INSERT INTO organization VALUES(1,'学校',0,NULL);",
+	"INSERT INTO organization VALUES(2,'单位',1,1);",
+	"INSERT INTO organization VALUES(3,'学院A',2,1);",
+	"INSERT INTO organization VALUES(4,'团支部A',3,3);",
+	"INSERT INTO organization VALUES(5,'学院B',2,1);",
+	"INSERT INTO organization VALUES(6,'团支部B',3,5);",
+	"INSERT INTO user VALUES('root','pw',0,1);",
+	"INSERT INTO user VALUES('school','pw',1,1);",
+	"INSERT INTO user VALUES('unit','pw',2,2);",
+	"INSERT INTO user VALUES('collegeA','pw',3,3);",
+	"INSERT INTO user VALUES('branchA','pw',4,4);",
+	"INSERT INTO user VALUES('collegeB','pw',3,5);",
+	"INSERT INTO user VALUES('branchB','pw',4,6);",
+	"INSERT INTO user VALUES('stuA','pw',5,4);",
+	"INSERT INTO user VALUES('stuB','pw',5,6);",
+	"INSERT INTO item VALUES(1,0,0,'志愿服务',1,4,1,'基础项目',0,'');",
+}
+
+func New_server(t *testing.T, options ...func(c *server.Config)) *server.Server {
+	// 使用内存数据库创建注册了全部路由的服务并写入测试数据；测试需在功能包目录下运行，模板位于 ../root/
+	gin.SetMode(gin.TestMode)
+	c := server.Default_config()
+	c.DB = ":memory:"
+	c.Templates = "../root/*"
+	c.Upload = t.TempDir()
+	for _, option := range options {
+		option(&c)
+	}
+	s, err := app.New(c)
+	if err != nil {
+		t.Fatalf("创建服务失败：%v", err)
+	}
+	t.Cleanup(func() { s.DB.Close() })
+	for _, sql := range Fixtures {
+		if !s.Exec(sql) {
+			t.Fatalf("写入测试数据失败：%s", sql)
+		}
+	}
+	return s
+}
+
+type Client struct {
+	T       *testing.T
+	S       *server.Server
+	Cookies map[string]*http.Cookie
+}
+
+func Anon(t *testing.T, s *server.Server) *Client {
+	// 未登录的客户端
+	return &Client{T: t, S: s, Cookies: map[string]*http.Cookie{}}
+}
+
+func (c *Client) Do(req *http.Request) *httptest.ResponseRecorder {
+	// 发送请求并像浏览器一样保存服务端下发的 Cookie
+	for _, cookie := range c.Cookies {
+		req.AddCookie(cookie)
+	}
+	w := httptest.NewRecorder()
+	c.S.Router.ServeHTTP(w, req)
+	for _, cookie := range w.Result().Cookies() {
+		if cookie.MaxAge < 0 {
+			delete(c.Cookies, cookie.Name)
+		} else {
+			c.Cookies[cookie.Name] = cookie
+		}
+	}
+	return w
+}
+
+func (c *Client) Get(path string) *httptest.ResponseRecorder {
+	return c.Do(httptest.NewRequest(http.MethodGet, path, nil))
+}
+
+func (c *Client) Post(path string, form url.Values) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	return c.Do(req)
+}
+
+func (c *Client) Upload(path string, form url.Values, name string, content string) *httptest.ResponseRecorder {
+	// 以 multipart/form-data 提交表单，附带一个附件
+	body := &bytes.Buffer{}
+	mw := multipart.NewWriter(body)
+	for k, vs := range form {
+		for _, v := range vs {
+			mw.WriteField(k, v)
+		}
+	}
+	fw, _ := mw.CreateFormFile("file1", name)
+	fw.Write([]byte(content))
+	mw.Close()
+	req := httptest.NewRequest(http.MethodPost, path, body)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	return c.Do(req)
+}
+
+func Login(t *testing.T, s *server.Server, userID string) *Client {
+	c := Anon(t, s)
+	w := c.Post("/login", url.Values{"login": {userID}, "pass": {"pw"}})
+	if w.Code != http.StatusTemporaryRedirect || c.Cookies["SessionID"] == nil {
+		t.Fatalf("%s 登录失败：%d %s", userID, w.Code, w.Body.String())
+	}
+	return c
+}
+
+func Expect_body(t *testing.T, w *httptest.ResponseRecorder, want string) {
+	t.Helper()
+	if !strings.Contains(w.Body.String(), want) {
+		t.Fatalf("响应中缺少「%s」：%d %s", want, w.Code, w.Body.String())
+	}
+}
+
+func Status_of(s *server.Server, table string, id int64) int64 {
+	field := map[string]string{"appliance": "applianceID", "item": "itemID"}[table]
+	res := s.Query(fmt.Sprintf("SELECT status FROM %s WHERE %s=%d;", table, field, id))
+	if len(res) == 0 {
+		return -1
+	}
+	return res[0]["status"].(int64)
+}
+
+func Apply(t *testing.T, s *server.Server, c *Client, content string) int64 {
+	// 学生申请基础项目1并上传附件，返回申请ID
+	w := c.Upload("/apply_item?ID=1", url.Values{"description": {"参加志愿服务"}}, "证明.txt", content)
+	Expect_body(t, w, "申请成功！")
+	res := s.Query("SELECT applianceID FROM appliance ORDER BY applianceID DESC LIMIT 1;")
+	return res[0]["applianceID"].(int64)
+}
+
+func Attachment_of(s *server.Server, owner_type string, ownerID int64) string {
+	// 申请或项目最早上传的附件ID
+	res := s.Query(fmt.Sprintf("SELECT attachmentID FROM attachment WHERE owner_type='%s' AND ownerID=%d ORDER BY time_unix;", owner_type, ownerID))
+	if len(res) == 0 {
+		return ""
+	}
+	return res[0]["attachmentID"].(string)
+}
+
+func Content_key(content string) string {
+	// 附件在附件存储中的键：内容的 SHA-256 摘要
+	sum := sha256.Sum256([]byte(content))
+	return hex.EncodeToString(sum[:])
+}
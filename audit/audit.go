@@ -0,0 +1,348 @@
+package audit
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"Gin-ZJUST/files"
+	"Gin-ZJUST/server"
+
+	"github.com/gin-gonic/gin"
+)
+
+var audit_operation = map[int64]string{ // 管理员类型 to 审核记录中的审核单位
+	0: "学校",
+	1: "学校",
+	3: "学院",
+	4: "团支部",
+}
+
+var audit_result = map[int64][2]int64{ // 管理员类型 to 审核通过、审核不通过后的申请状态
+	0: {5, 6},
+	1: {5, 6},
+	3: {3, 4},
+	4: {1, 2},
+}
+
+func append_record(record_str string, operator string, operation string) string {
+	// 在JSON格式的操作记录末尾追加一条记录
+	records := []map[string]any{}
+	json.Unmarshal([]byte(record_str), &records)
+	records = append(records, map[string]any{
+		"operator":  operator,
+		"time":      strconv.Itoa(int(time.Now().Unix())),
+		"operation": operation,
+	})
+	res, _ := json.Marshal(records)
+	return string(res)
+}
+
+func Check_audit_appliance(s *server.Server, account_type int64, admin_org int64, applianceID int64) (map[string]any, error) {
+	// 检验是否有审核权限(是否属于同一级审核、是否处于对应组织管理下)，返回申请记录
+	appliance := s.Query(fmt.Sprintf("SELECT * FROM appliance WHERE applianceID=%d;", applianceID))
+	if len(appliance) == 0 {
+		return nil, server.Err_not_found
+	}
+	can_audit_status, ok := server.To_audit_map[account_type]
+	if !ok || can_audit_status != appliance[0]["status"].(int64) {
+		return nil, server.Err_forbidden
+	}
+	if !s.Student_in_scope(account_type, admin_org, appliance[0]["userID"].(string)) {
+		return nil, server.Err_forbidden
+	}
+	return appliance[0], nil
+}
+
+func check_score(s *server.Server, itemID int64, score *float64) error {
+	// 记点须在项目的分值范围内
+	if score == nil {
+		return &server.Error{Status: http.StatusBadRequest, Code: "bad_request", Msg: "审核通过时须填写记点"}
+	}
+	item, err := s.Query_one(fmt.Sprintf("SELECT score_lower_range,score_higher_range FROM item WHERE itemID=%d;", itemID))
+	if err != nil {
+		return err
+	}
+	lower, ok := item["score_lower_range"].(float64)
+	higher, ok2 := item["score_higher_range"].(float64)
+	if !ok || !ok2 {
+		return server.Internal(fmt.Errorf("项目分值范围类型有误：%T %T", item["score_lower_range"], item["score_higher_range"]))
+	}
+	if !(*score >= lower && *score <= higher) {
+		return &server.Error{Status: http.StatusBadRequest, Code: "bad_request", Msg: fmt.Sprintf("记点须在 %g 到 %g 之间", lower, higher)}
+	}
+	return nil
+}
+
+func Audit_appliance(s *server.Server, userID string, account_type int64, admin_org int64, applianceID int64, pass bool, opinion string, score *float64) error {
+	// 审核基础项目申请：团支部、学院、学校逐级审核，学院审核通过时确定记点，score 为 nil 表示未填写
+	appliance, err := Check_audit_appliance(s, account_type, admin_org, applianceID)
+	if err != nil {
+		return err
+	}
+	scored := account_type == 3 && pass
+	if scored {
+		if err = check_score(s, appliance["itemID"].(int64), score); err != nil {
+			return err
+		}
+	}
+	operation := audit_operation[account_type]
+	status := audit_result[account_type][1]
+	if pass {
+		operation += "审核通过："
+		status = audit_result[account_type][0]
+	} else {
+		operation += "审核不通过："
+	}
+	operation += opinion
+	record_str := append_record(appliance["record"].(string), userID, operation)
+	if scored {
+		_, err = s.DB.Exec("UPDATE appliance SET status=?,record=?,score=? WHERE applianceID=?;", status, record_str, *score, applianceID)
+	} else {
+		_, err = s.DB.Exec("UPDATE appliance SET status=?,record=? WHERE applianceID=?;", status, record_str, applianceID)
+	}
+	if err == nil {
+		s.Metrics.Appliance_audited(account_type, pass, 1)
+	}
+	return err
+}
+
+func Audit_activity_item(s *server.Server, userID string, itemID int64, action int64, opinion string) error {
+	// 校级审核非基础项目，审核通过或不通过时同步更新导入的学生申请
+	if _, ok := server.Item_status[action]; !ok || action == 1 {
+		return server.Err_bad_request
+	}
+	item := s.Query(fmt.Sprintf("SELECT * FROM item WHERE itemID=%d;", itemID))
+	if len(item) == 0 {
+		return server.Err_not_found
+	}
+	// 只能审核待审核、预审核通过的非基础项目，审核完成后不能再修改结果
+	if item[0]["type"].(int64) < 2 || item[0]["status"] != int64(1) && item[0]["status"] != int64(2) {
+		return server.Err_forbidden
+	}
+	record_str, _ := item[0]["record"].(string)
+	record_str = append_record(record_str, userID, server.Item_status[action]+"。审核意见："+opinion)
+
+	tx, err := s.DB.Beginx()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if _, err = tx.Exec("UPDATE item SET status=?,record=? WHERE itemID=?;", action, record_str, itemID); err != nil {
+		return err
+	}
+	var audited int64
+	if action == 4 || action == 5 {
+		var res sql.Result
+		// 只更新导入的申请，学生自己提交的申请按基础项目流程逐级审核
+		if action == 4 {
+			res, err = tx.Exec("UPDATE appliance SET status=5,record=? WHERE itemID=? AND description='导入项目';", record_str, itemID)
+		} else {
+			res, err = tx.Exec("UPDATE appliance SET status=6,record=? WHERE itemID=? AND description='导入项目';", record_str, itemID)
+		}
+		if err == nil {
+			audited, _ = res.RowsAffected()
+		}
+	}
+	if err != nil {
+		return err
+	}
+	if err = tx.Commit(); err != nil {
+		return err
+	}
+	// 导入的学生申请随立项项目一并由学校审核
+	s.Metrics.Appliance_audited(1, action == 4, audited)
+	return nil
+}
+
+const Pending_fields = "ap.applianceID AS applianceID,ap.userID AS userID,item.name AS item,item.type AS type,ap.score AS score,ap.description AS description,ap.status AS status" // 待审核申请列表的字段
+const Pending_tables = "appliance AS ap,item,user"
+
+func Pending_cond(account_type int64, admin_org int64) string {
+	// 管辖范围内需要当前管理员审核的申请，返回 SQL 条件；不参与审核的管理员不匹配任何申请
+	to_audit, ok := server.To_audit_map[account_type]
+	if !ok {
+		return "1=0"
+	}
+	return fmt.Sprintf("ap.itemID=item.itemID AND ap.userID=user.userID AND ap.status=%d AND user.account_type=5 AND %s", to_audit, server.Scope_orgs(account_type, admin_org))
+}
+
+func Mark_quarantined(s *server.Server, appliances []map[string]any) {
+	// 标记有附件未通过病毒扫描的申请
+	applianceIDs := []int64{}
+	for _, ap := range appliances {
+		applianceIDs = append(applianceIDs, ap["applianceID"].(int64))
+	}
+	quarantined := files.Quarantined(s, files.Owner_appliance, applianceIDs)
+	for _, ap := range appliances {
+		ap["quarantined"] = quarantined[ap["applianceID"].(int64)]
+	}
+}
+
+func Pending_appliances(s *server.Server, account_type int64, admin_org int64) []map[string]any {
+	// 检索管辖范围内所有需要当前管理员审核的申请
+	appliances := s.Query(fmt.Sprintf("SELECT %s FROM %s WHERE %s;", Pending_fields, Pending_tables, Pending_cond(account_type, admin_org)))
+	Mark_quarantined(s, appliances)
+	return appliances
+}
+
+// 基础项目申请的逐级审核、非基础项目的校级审核
+func Register(s *server.Server) {
+	r := s.Router
+
+	audit_basic := func(c *gin.Context) {
+		// 检索管辖范围内所有需要审核的申请
+		appliances := Pending_appliances(s, c.GetInt64("account_type"), c.GetInt64("belonging_org"))
+		for _, ap := range appliances {
+			ap["type"] = server.Item_types[ap["type"].(int64)]
+			ap["status"] = server.Appliance_status[ap["status"].(int64)]
+		}
+		c.HTML(http.StatusOK, "audit_basic.html", gin.H{
+			"msg":          "",
+			"to_audit_sum": len(appliances),
+			"appliances":   appliances,
+		})
+	}
+	r.GET("/audit_basic.html", s.Midware_Auth, s.Authorities(0b011011), s.Permission(server.Perm_audit_basic), audit_basic)
+	r.POST("/audit_basic.html", s.Midware_Auth, s.Authorities(0b011011), s.Permission(server.Perm_audit_basic), audit_basic)
+
+	r.GET("/audit_detail", s.Midware_Auth, s.Authorities(0b011011), s.Permission(server.Perm_audit_basic), s.Handle(func(c *gin.Context) error {
+		// 检验是否有审核权限(是否属于同一级审核、是否处于对应组织管理下)
+		account_type := c.GetInt64("account_type")
+		applianceID, err := strconv.ParseInt(c.Query("applianceID"), 10, 64)
+		if err != nil {
+			return server.Err_bad_request
+		}
+		if _, err = Check_audit_appliance(s, account_type, c.GetInt64("belonging_org"), applianceID); err != nil {
+			return err
+		}
+		sql := fmt.Sprintf("SELECT ap.applianceID AS applianceID,ap.userID AS userID, item.name AS item, item.type AS type, ap.score AS score, ap.description AS description, ap.status AS status, ap.time_unix AS time_unix FROM appliance as ap,item WHERE ap.itemID=item.itemID AND ap.applianceID=%d;", applianceID)
+		ap, err := s.Query_one(sql)
+		if err != nil {
+			return err
+		}
+		ap["status"] = server.Appliance_status[ap["status"].(int64)]
+		ap["type"] = server.Item_types[ap["type"].(int64)]
+		ap["quarantined"] = files.Quarantined(s, files.Owner_appliance, []int64{applianceID})[applianceID]
+		// 审核人可查看学生提交的证明材料
+		paths := files.List(s, files.Owner_appliance, applianceID)
+		c.HTML(http.StatusOK, "audit_detail.html", gin.H{
+			"appliance":    ap,
+			"account_type": account_type,
+			"paths":        paths,
+		})
+		return nil
+	}))
+
+	r.POST("/audit_basic_item", s.Midware_Auth, s.Authorities(0b011011), s.Permission(server.Perm_audit_basic), s.Handle(func(c *gin.Context) error {
+		account_type := c.GetInt64("account_type")
+		applianceID, err := strconv.ParseInt(c.Query("applianceID"), 10, 64)
+		if err != nil {
+			return server.Err_bad_request
+		}
+		var score *float64
+		if v, err := strconv.ParseFloat(c.PostForm("score"), 64); err == nil && account_type == 3 {
+			// 学院审核时确定申请记点
+			score = &v
+		}
+		err = Audit_appliance(s, c.GetString("userID"), account_type, c.GetInt64("belonging_org"), applianceID, c.PostForm("option") == "1", c.PostForm("opinion"), score)
+		if err != nil {
+			return err
+		}
+		c.Redirect(http.StatusTemporaryRedirect, "audit_basic.html")
+		return nil
+	}))
+
+	r.GET("/audit_added.html", s.Midware_Auth, s.Authorities(0b000011), func(c *gin.Context) {
+		sql := "SELECT * FROM item WHERE status=1 OR status=2"
+		items := s.Query(sql)
+		sum2, sum3 := 0, 0
+		for _, item := range items {
+			if item["type"].(int64) == 2 {
+				sum2++
+			} else {
+				sum3++
+			}
+			item["type"] = server.Item_types[item["type"].(int64)]
+			item["status"] = server.Item_status[item["status"].(int64)]
+		}
+		c.HTML(http.StatusOK, "audit_added.html", gin.H{
+			"added": items,
+			"sum2":  sum2,
+			"sum3":  sum3,
+		})
+	})
+
+	r.POST("/audit_added.html", s.Midware_Auth, s.Authorities(0b000011), func(c *gin.Context) {
+		sql := "SELECT * FROM item WHERE status=1 OR status=2"
+		items := s.Query(sql)
+		sum2, sum3 := 0, 0
+		for _, item := range items {
+			if item["type"].(int64) == 2 {
+				sum2++
+			} else {
+				sum3++
+			}
+			item["type"] = server.Item_types[item["type"].(int64)]
+			item["status"] = server.Item_status[item["status"].(int64)]
+		}
+		c.HTML(http.StatusOK, "audit_added.html", gin.H{
+			"added": items,
+			"sum2":  sum2,
+			"sum3":  sum3,
+		})
+	})
+
+	r.GET("/audit_added_detail", s.Midware_Auth, s.Authorities(0b000011), s.Handle(func(c *gin.Context) error {
+		itemID, err := strconv.ParseInt(c.Query("itemID"), 10, 64)
+		if err != nil {
+			return server.Err_bad_request
+		}
+		item, err := s.Query_one(fmt.Sprintf("SELECT * FROM item WHERE itemID=%d;", itemID))
+		if err != nil {
+			return err
+		}
+		create_org, _ := item["create_org"].(int64)
+		item["create_org"] = s.Org_name(create_org)
+		paths := files.List(s, files.Owner_item, itemID)
+		list := []map[string]any{}
+		if status := item["status"].(int64); status == 2 || status == 4 || status == 5 {
+			list = s.Query(fmt.Sprintf("SELECT * FROM appliance WHERE itemID=%d;", itemID))
+			for _, ap := range list {
+				ap["status"] = server.Appliance_status[ap["status"].(int64)]
+			}
+		}
+
+		records_str, _ := item["record"].(string)
+		records := []map[string]any{}
+		json.Unmarshal([]byte(records_str), &records)
+		item["type"] = server.Item_types[item["type"].(int64)]
+		item["status"] = server.Item_status[item["status"].(int64)]
+		c.HTML(http.StatusOK, "audit_added_detail.html", gin.H{
+			"item":    item,
+			"list":    list,
+			"records": records,
+			"paths":   paths,
+		})
+		return nil
+	}))
+
+	r.POST("/audit_added_item", s.Midware_Auth, s.Authorities(0b000011), s.Handle(func(c *gin.Context) error {
+		itemID, err := strconv.ParseInt(c.Query("itemID"), 10, 64)
+		if err != nil {
+			return server.Err_bad_request
+		}
+		action, err := strconv.ParseInt(c.PostForm("action"), 10, 64)
+		if err != nil {
+			return server.Err_bad_request
+		}
+		if err = Audit_activity_item(s, c.GetString("userID"), itemID, action, c.PostForm("opinion")); err != nil {
+			return err
+		}
+		c.Redirect(http.StatusTemporaryRedirect, "/audit_added.html")
+		return nil
+	}))
+}
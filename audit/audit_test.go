@@ -0,0 +1,126 @@
+package audit_test
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"Gin-ZJUST/apptest"
+)
+
+func TestBasicApplianceThreeLevelAudit(t *testing.T) {
+	s := apptest.New_server(t)
+	stu := apptest.Login(t, s, "stuA")
+	apptest.Expect_body(t, stu.Get("/apply.html"), "志愿服务")
+	id := apptest.Apply(t, s, stu, "证明材料")
+	if apptest.Status_of(s, "appliance", id) != 0 {
+		t.Fatal("新申请应为待审核")
+	}
+	path := fmt.Sprintf("/audit_basic_item?applianceID=%d", id)
+	pass := url.Values{"option": {"1"}, "opinion": {"同意"}, "score": {"2"}}
+
+	// 学生无审核权限，其他团支部和尚未轮到的审核级别不能审核
+	apptest.Expect_body(t, stu.Post(path, pass), "权限不足")
+	apptest.Expect_body(t, apptest.Login(t, s, "branchB").Post(path, pass), "权限不足")
+	apptest.Expect_body(t, apptest.Login(t, s, "collegeA").Post(path, pass), "权限不足")
+	if apptest.Status_of(s, "appliance", id) != 0 {
+		t.Fatal("越权审核不应改变申请状态")
+	}
+
+	// 团支部、学院、学校逐级审核
+	steps := []struct {
+		userID string
+		status int64
+	}{{"branchA", 1}, {"collegeA", 3}, {"school", 5}}
+	for _, step := range steps {
+		c := apptest.Login(t, s, step.userID)
+		apptest.Expect_body(t, c.Get("/audit_basic.html"), fmt.Sprintf("applianceID&#61;%d", id))
+		if w := c.Post(path, pass); w.Code != http.StatusTemporaryRedirect {
+			t.Fatalf("%s 审核失败：%d %s", step.userID, w.Code, w.Body.String())
+		}
+		if got := apptest.Status_of(s, "appliance", id); got != step.status {
+			t.Fatalf("%s 审核后状态为 %d，应为 %d", step.userID, got, step.status)
+		}
+	}
+	apptest.Expect_body(t, apptest.Login(t, s, "collegeB").Post(path, pass), "权限不足")
+
+	// 学院审核时确定记点，审核通过后计入第二课堂学分
+	if score := s.Query(fmt.Sprintf("SELECT score FROM appliance WHERE applianceID=%d;", id))[0]["score"].(float64); score != 2 {
+		t.Fatalf("记点为 %v，应为 2", score)
+	}
+	w := stu.Get("/check_record.html")
+	apptest.Expect_body(t, w, "学校审核通过")
+
+	// 审核不通过
+	stuB := apptest.Login(t, s, "stuB")
+	idB := apptest.Apply(t, s, stuB, "证明材料")
+	apptest.Login(t, s, "branchB").Post(fmt.Sprintf("/audit_basic_item?applianceID=%d", idB), url.Values{"option": {"0"}, "opinion": {"材料不全"}})
+	if apptest.Status_of(s, "appliance", idB) != 2 {
+		t.Fatal("团支部审核不通过后状态应为 2")
+	}
+	apptest.Expect_body(t, stuB.Get(fmt.Sprintf("/appliance_detail?applianceID=%d", idB)), "材料不全")
+}
+
+func TestActivityItemApproval(t *testing.T) {
+	s := apptest.New_server(t)
+	college := apptest.Login(t, s, "collegeA")
+	w := college.Upload("/add_activity_item", url.Values{
+		"name":               {"学院讲座"},
+		"type":               {"2"},
+		"score_lower_range":  {"0.5"},
+		"score_higher_range": {"1"},
+		"description":        {"讲座"},
+	}, "策划案.txt", "策划")
+	apptest.Expect_body(t, w, "添加成功！")
+	itemID := s.Query("SELECT itemID FROM item WHERE name='学院讲座';")[0]["itemID"].(int64)
+	if apptest.Status_of(s, "item", itemID) != 1 {
+		t.Fatal("新立项项目应为待审核")
+	}
+	apptest.Expect_body(t, college.Upload("/add_activity_item", url.Values{"name": {"学院讲座"}, "type": {"2"}}, "a.txt", ""), "项目名称重复")
+
+	// 只有学校管理员、超级管理员可审核立项项目，其他学院不能查看立项详情
+	path := fmt.Sprintf("/audit_added_item?itemID=%d", itemID)
+	apptest.Expect_body(t, college.Post(path, url.Values{"action": {"4"}}), "权限不足")
+	apptest.Expect_body(t, apptest.Login(t, s, "collegeB").Get(fmt.Sprintf("/added_item_detail?itemID=%d", itemID)), "权限不足")
+
+	school := apptest.Login(t, s, "school")
+	apptest.Expect_body(t, school.Get("/audit_added.html"), "学院讲座")
+	apptest.Expect_body(t, school.Post(path, url.Values{"action": {"1"}}), "输入有误")
+	if w := school.Post(path, url.Values{"action": {"2"}, "opinion": {"可以举办"}}); w.Code != http.StatusTemporaryRedirect {
+		t.Fatalf("预审核失败：%d %s", w.Code, w.Body.String())
+	}
+	if apptest.Status_of(s, "item", itemID) != 2 {
+		t.Fatal("预审核通过后状态应为 2")
+	}
+
+	// 预审核通过后导入参加活动的学生名单，不存在的学生计为导入失败
+	w = college.Post(fmt.Sprintf("/import_student_list?itemID=%d", itemID), url.Values{"list": {`[{"ID":"stuA","score":1},{"ID":"nobody","score":1}]`}})
+	apptest.Expect_body(t, w, "共导入 2 条，其中导入失败 1 条。")
+	apptest.Expect_body(t, w, "stuA")
+
+	s.Exec(fmt.Sprintf("INSERT INTO appliance VALUES(NULL,%d,'stuB',0,0,'[\"本人提交\"]',0,'参加讲座');", itemID))
+	own := s.Query("SELECT applianceID FROM appliance WHERE userID='stuB';")[0]["applianceID"].(int64)
+
+	if w := school.Post(path, url.Values{"action": {"4"}, "opinion": {"通过"}}); w.Code != http.StatusTemporaryRedirect {
+		t.Fatalf("审核失败：%d %s", w.Code, w.Body.String())
+	}
+	if apptest.Status_of(s, "item", itemID) != 4 {
+		t.Fatal("审核通过后状态应为 4")
+	}
+	res := s.Query(fmt.Sprintf("SELECT status FROM appliance WHERE itemID=%d AND userID='stuA';", itemID))
+	if len(res) != 1 || res[0]["status"].(int64) != 5 {
+		t.Fatalf("审核通过后学生的申请应为学校审核通过：%v", res)
+	}
+	apptest.Expect_body(t, apptest.Login(t, s, "stuA").Get("/check_record.html"), "学院讲座")
+
+	// 学生自己提交的申请不随立项审核改变；审核完成后不能再次审核
+	if ap := s.Query(fmt.Sprintf("SELECT status,record FROM appliance WHERE applianceID=%d;", own)); ap[0]["status"] != int64(0) || ap[0]["record"] != `["本人提交"]` {
+		t.Fatalf("立项审核修改了学生自己提交的申请：%v", ap)
+	}
+	apptest.Expect_body(t, school.Post(path, url.Values{"action": {"5"}, "opinion": {"撤销"}}), "权限不足")
+	if apptest.Status_of(s, "item", itemID) != 4 || len(s.Query(fmt.Sprintf("SELECT * FROM appliance WHERE itemID=%d AND status=6;", itemID))) != 0 {
+		t.Fatal("审核完成的项目不应再次审核")
+	}
+	apptest.Expect_body(t, school.Post("/audit_added_item?itemID=1", url.Values{"action": {"4"}}), "权限不足")
+}
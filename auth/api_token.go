@@ -0,0 +1,90 @@
+package auth
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"Gin-ZJUST/server"
+)
+
+var token_scopes = map[string]string{ // API令牌权限范围 to 说明
+	"read":  "查询",
+	"write": "提交、撤回申请",
+	"audit": "审核",
+}
+
+var token_valid_days = []int64{7, 30, 90, 365, 0} // 可选的有效期（天），0 为永不过期
+
+func create_api_token(s *server.Server, userID string, name string, scopes []string, days int64) (string, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return "", fmt.Errorf("请填写令牌名称")
+	}
+	valid := []string{}
+	for _, scope := range scopes {
+		if _, ok := token_scopes[scope]; ok {
+			valid = append(valid, scope)
+		}
+	}
+	if len(valid) == 0 {
+		return "", fmt.Errorf("请至少选择一项权限")
+	}
+	ok := false
+	for _, d := range token_valid_days {
+		ok = ok || d == days
+	}
+	if !ok {
+		return "", fmt.Errorf("有效期有误")
+	}
+	now := time.Now().Unix()
+	var due int64
+	if days != 0 {
+		due = now + days*86400
+	}
+	token := "zjust_" + server.Produce_token()
+	if _, err := s.DB.Exec("INSERT INTO api_token VALUES(NULL,?,?,?,?,?,?,0,0);", userID, name, server.Hash_api_token(token), strings.Join(valid, ","), now, due); err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+func revoke_api_token(s *server.Server, userID string, tokenID int64) error {
+	res, err := s.DB.Exec("UPDATE api_token SET revoked=? WHERE tokenID=? AND userID=? AND revoked=0;", time.Now().Unix(), tokenID, userID)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return fmt.Errorf("令牌不存在或已撤销")
+	}
+	return nil
+}
+
+func user_api_tokens(s *server.Server, userID string) []map[string]any {
+	tokens := s.Query(fmt.Sprintf("SELECT * FROM api_token WHERE userID=%s ORDER BY tokenID DESC;", server.Join_strs([]string{userID})))
+	now := time.Now().Unix()
+	for _, token := range tokens {
+		token["created"] = time.Unix(token["created"].(int64), 0).Format("2006-01-02 15:04")
+		if due := token["due"].(int64); due == 0 {
+			token["due"] = "永不过期"
+		} else {
+			token["expired"] = now > due
+			token["due"] = time.Unix(due, 0).Format("2006-01-02 15:04")
+		}
+		if last := token["last_used"].(int64); last == 0 {
+			token["last_used"] = "从未使用"
+		} else {
+			token["last_used"] = time.Unix(last, 0).Format("2006-01-02 15:04")
+		}
+	}
+	return tokens
+}
+
+func api_token_logs(s *server.Server, userID string, limit int) []map[string]any {
+	// 查询用户令牌最近的使用记录
+	logs := s.Query(fmt.Sprintf("SELECT api_token.name AS name,log.time AS time,log.method AS method,log.path AS path,log.ip AS ip,log.status AS status FROM api_token_log AS log,api_token WHERE log.tokenID=api_token.tokenID AND api_token.userID=%s ORDER BY log.logID DESC LIMIT %d;", server.Join_strs([]string{userID}), limit))
+	for _, log := range logs {
+		log["time"] = time.Unix(log["time"].(int64), 0).Format("2006-01-02 15:04:05")
+	}
+	return logs
+}
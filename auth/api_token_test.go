@@ -0,0 +1,92 @@
+package auth_test
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"Gin-ZJUST/apptest"
+	"Gin-ZJUST/server"
+)
+
+func create_token(t *testing.T, c *apptest.Client, scopes ...string) string {
+	// 在个人信息管理页面创建API令牌，返回令牌明文
+	w := c.Post("/create_api_token", url.Values{"name": {"脚本"}, "scopes": scopes, "days": {"30"}})
+	apptest.Expect_body(t, w, "新令牌：")
+	return strings.Fields(strings.SplitN(w.Body.String(), "新令牌：", 2)[1])[0]
+}
+
+func token_status(s *server.Server, token string, method string, path string) int {
+	req := httptest.NewRequest(method, path, strings.NewReader("{}"))
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	s.Router.ServeHTTP(w, req)
+	return w.Code
+}
+
+func TestAPITokens(t *testing.T) {
+	s := apptest.New_server(t)
+
+	// 权限范围由接口声明：查询需要 read，提交、撤回申请需要 write，审核需要 audit
+	college := apptest.Login(t, s, "collegeA")
+	read := create_token(t, college, "read")
+	auditing := create_token(t, college, "audit")
+	for _, tc := range []struct {
+		token  string
+		method string
+		path   string
+		want   int
+	}{
+		{read, http.MethodGet, "/api/v1/me", http.StatusOK},
+		{read, http.MethodGet, "/api/v1/items", http.StatusOK},
+		{read, http.MethodGet, "/api/v1/audits/pending", http.StatusForbidden},
+		{read, http.MethodPost, "/api/v1/appliances/1/audit", http.StatusForbidden},
+		{auditing, http.MethodGet, "/api/v1/audits/pending", http.StatusOK},
+		{auditing, http.MethodGet, "/api/v1/me", http.StatusForbidden},
+		{"zjust_unknown", http.MethodGet, "/api/v1/me", http.StatusUnauthorized},
+	} {
+		if code := token_status(s, tc.token, tc.method, tc.path); code != tc.want {
+			t.Fatalf("%s %s 应返回 %d：%d", tc.method, tc.path, tc.want, code)
+		}
+	}
+	stu := apptest.Login(t, s, "stuA")
+	write := create_token(t, stu, "read", "write")
+	if code := token_status(s, write, http.MethodPost, "/api/v1/appliances"); code == http.StatusForbidden || code == http.StatusUnauthorized {
+		t.Fatalf("write 令牌应能提交申请：%d", code)
+	}
+	if code := token_status(s, read, http.MethodPost, "/api/v1/appliances"); code != http.StatusForbidden {
+		t.Fatalf("read 令牌不应能提交申请：%d", code)
+	}
+
+	// 过期与撤销
+	s.Exec("UPDATE api_token SET due=1 WHERE userID='collegeA' AND scopes='audit';")
+	if code := token_status(s, auditing, http.MethodGet, "/api/v1/audits/pending"); code != http.StatusUnauthorized {
+		t.Fatalf("过期的令牌应返回 401：%d", code)
+	}
+	tokenID := s.Query("SELECT tokenID FROM api_token WHERE userID='collegeA' AND scopes='read';")[0]["tokenID"].(int64)
+	apptest.Expect_body(t, college.Post("/revoke_api_token", url.Values{"tokenID": {fmt.Sprint(tokenID)}}), "令牌已撤销")
+	if code := token_status(s, read, http.MethodGet, "/api/v1/me"); code != http.StatusUnauthorized {
+		t.Fatalf("撤销的令牌应返回 401：%d", code)
+	}
+
+	// 修改密码、删除账号后撤销该用户的全部令牌
+	read = create_token(t, college, "read")
+	apptest.Expect_body(t, college.Post("/change_passwd", url.Values{"new_passwd": {"pw2"}}), "修改成功")
+	if code := token_status(s, read, http.MethodGet, "/api/v1/me"); code != http.StatusUnauthorized {
+		t.Fatalf("修改密码后令牌应失效：%d", code)
+	}
+	if code := token_status(s, write, http.MethodGet, "/api/v1/me"); code != http.StatusOK {
+		t.Fatalf("其他用户的令牌不受影响：%d", code)
+	}
+	apptest.Expect_body(t, apptest.Login(t, s, "school").Get("/delete_stu?name=stuA"), "删除成功！")
+	if code := token_status(s, write, http.MethodGet, "/api/v1/me"); code != http.StatusUnauthorized {
+		t.Fatalf("删除账号后令牌应失效：%d", code)
+	}
+	if n := len(s.Query("SELECT * FROM api_token WHERE revoked=0;")); n != 0 {
+		t.Fatalf("仍有 %d 个未撤销的令牌", n)
+	}
+}
@@ -0,0 +1,285 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"Gin-ZJUST/files"
+	"Gin-ZJUST/server"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 登录、退出、个人中心、个人信息管理（密码、邮箱、两步验证、API令牌）、密码重置与统一身份认证
+func Register(s *server.Server) {
+	r := s.Router
+
+	r.GET("/", func(c *gin.Context) {
+		// 首页，无需登录
+		// 检查登录状态，若已登录则显示个人中心，若未登录则显示登录界面
+		var welcome, link string
+		if SessionID, err := c.Cookie("SessionID"); err == nil {
+			if info, OK := s.Sessions.Get(SessionID); OK {
+				// Session未过期，即已登录
+				username := info["userID"].(string)
+				welcome = "Welcome, " + username
+				link = "personal_center"
+			} else {
+				// Session过期，视作未登录
+				welcome = "您尚未登录"
+				link = "login"
+			}
+		} else {
+			// 无Session，即未登录
+			welcome = "您尚未登录"
+			link = "login"
+		}
+
+		c.HTML(http.StatusOK, "index.html", gin.H{
+			"welcome": welcome,
+			"link":    link,
+		})
+
+	})
+	r.GET("/login.html", s.Midware_Auth, s.Authorities(0b111111), func(c *gin.Context) {
+		// 登录页面，若已登录则直接跳转到首页
+		if login_status, exist := c.Get("login_status"); exist && login_status.(bool) {
+			userID := c.GetString("userID")
+			c.HTML(http.StatusOK, "index.html", gin.H{
+				"welcome": "welcome" + userID,
+				"link":    "personal_center",
+			})
+		} else {
+			c.HTML(http.StatusOK, "login.html", gin.H{
+				"msg": "请登录后访问",
+			})
+		}
+	})
+	r.POST("/login", func(c *gin.Context) {
+		// 登录页面处理
+		login := c.PostForm("login")
+		passwd_get := c.PostForm("pass")
+		sql := fmt.Sprintf("SELECT * FROM user WHERE userID=\"%s\"", login)
+		query_res := s.Query(sql)
+		if len(query_res) == 0 {
+			c.HTML(http.StatusOK, "login.html", gin.H{
+				"msg": "用户不存在！请再次尝试。",
+			})
+			c.Abort()
+		} else {
+			passwd_need := query_res[0]["passwd"].(string)
+			if passwd_get == passwd_need {
+				finish_login(s, c, login, http.StatusTemporaryRedirect)
+			} else {
+				c.HTML(http.StatusOK, "login.html", gin.H{
+					"msg": "密码错误，请再次尝试。",
+				})
+			}
+		}
+	})
+
+	home := func(c *gin.Context) {
+		// 后台页面，需要登录
+		userID := c.GetString("userID")
+		account_type := c.GetInt64("account_type")
+		var add_item, add_basic_item, apply, audit_added, audit_basic, check_branch_info,
+			check_record, check_student_info, create_new_org, create_new_manager, item_anal, manage_self_info, import_new_student, manage_admins int
+		set_authorities := func(a int) {
+			// 根据变量定义顺序，从低位到高位依次赋值
+			varieties := []*int{&add_item, &add_basic_item, &apply, &audit_added, &audit_basic, &check_branch_info, &check_record, &check_student_info, &create_new_org, &create_new_manager, &item_anal, &manage_self_info, &import_new_student, &manage_admins}
+			idx := 0
+			for a > 0 {
+				if a&1 == 1 {
+					*varieties[idx] = 1
+				}
+				a >>= 1
+				idx++
+			}
+		}
+		set_authorities(s.User_authorities(userID, account_type))
+
+		c.HTML(http.StatusOK, "home.html", gin.H{
+			"msg":                "Welcome, " + userID,
+			"add_item":           add_item,
+			"add_basic_item":     add_basic_item,
+			"apply":              apply,
+			"audit_added":        audit_added,
+			"audit_basic":        audit_basic,
+			"check_branch_info":  check_branch_info,
+			"check_record":       check_record,
+			"check_student_info": check_student_info,
+			"create_new_org":     create_new_org,
+			"create_new_manager": create_new_manager,
+			"item_anal":          item_anal,
+			"manage_self_info":   manage_self_info,
+			"import_new_student": import_new_student,
+			"manage_admins":      manage_admins,
+			"storage_usage":      account_type == 0 || account_type == 1,
+		})
+	}
+	if s.Sso_enabled("oidc") {
+		r.GET("/sso/oidc/login", func(c *gin.Context) { oidc_login(s, c) })
+		r.GET("/sso/oidc/callback", func(c *gin.Context) { oidc_callback(s, c) })
+	}
+	if s.Sso_enabled("cas") {
+		r.GET("/sso/cas/login", func(c *gin.Context) { cas_login(s, c) })
+		r.GET("/sso/cas/callback", func(c *gin.Context) { cas_callback(s, c) })
+	}
+
+	r.GET("/home.html", s.Midware_Auth, s.Authorities(0b111111), home)
+	r.POST("/home.html", s.Midware_Auth, s.Authorities(0b111111), home)
+
+	r.GET("/logout", func(c *gin.Context) {
+		// 退出登录
+		if SessionID, err := c.Cookie("SessionID"); err == nil {
+			s.Sessions.Del(SessionID)
+		}
+		s.Set_cookie(c, "SessionID", "", -1)
+		c.Redirect(http.StatusTemporaryRedirect, "/")
+	})
+
+	render_self_info := func(c *gin.Context, msg string, extra gin.H) {
+		userID := c.GetString("userID")
+		data := gin.H{
+			"msg":          msg,
+			"userID":       userID,
+			"email":        user_email(s, userID),
+			"totp_account": totp_account(c.GetInt64("account_type")),
+			"totp_enabled": totp_enabled(s, userID),
+			"token_scopes": token_scopes,
+			"token_days":   token_valid_days,
+			"api_tokens":   user_api_tokens(s, userID),
+			"token_logs":   api_token_logs(s, userID, 20),
+			"quota":        files.Quota(s, c),
+		}
+		for k, v := range extra {
+			data[k] = v
+		}
+		c.HTML(http.StatusOK, "manage_self_info.html", data)
+	}
+
+	r.GET("/manage_self_info.html", s.Midware_Auth, s.Authorities(0b111111), func(c *gin.Context) {
+		render_self_info(c, "", gin.H{})
+	})
+	r.POST("/change_passwd", s.Midware_Auth, s.Authorities(0b111111), func(c *gin.Context) {
+		new_passwd := c.PostForm("new_passwd")
+		userID := c.GetString("userID")
+		sql := fmt.Sprintf("UPDATE user SET passwd=\"%s\" WHERE userID=\"%s\"", new_passwd, userID)
+		ok := s.Exec(sql)
+		msg := ""
+		if ok {
+			msg = "修改成功！"
+			// 修改密码后重新生成Session，旧的SessionID立即失效，不保留宽限期
+			s.Start_session(c, userID)
+		} else {
+			msg = "修改失败"
+		}
+		render_self_info(c, msg, gin.H{})
+	})
+	r.POST("/change_email", s.Midware_Auth, s.Authorities(0b111111), func(c *gin.Context) {
+		userID := c.GetString("userID")
+		msg := "修改成功！"
+		if err := set_user_email(s, userID, c.PostForm("email")); errors.Is(err, err_bad_email) {
+			msg = "修改失败：" + err.Error()
+		} else if err != nil {
+			msg = "修改失败"
+		}
+		render_self_info(c, msg, gin.H{})
+	})
+
+	r.POST("/totp_enroll", s.Midware_Auth, s.Authorities(0b001111), func(c *gin.Context) {
+		secret, uri, err := totp_begin_enroll(s, c.GetString("userID"))
+		if err != nil {
+			render_self_info(c, "生成密钥失败："+err.Error(), gin.H{})
+			return
+		}
+		render_self_info(c, "请在身份验证器中添加以下密钥，并输入动态口令完成启用", gin.H{
+			"totp_secret": secret,
+			"totp_uri":    uri,
+		})
+	})
+	r.POST("/totp_confirm", s.Midware_Auth, s.Authorities(0b001111), func(c *gin.Context) {
+		userID := c.GetString("userID")
+		codes, err := totp_confirm_enroll(s, userID, strings.TrimSpace(c.PostForm("code")))
+		if err != nil {
+			render_self_info(c, "启用失败："+err.Error(), gin.H{})
+			return
+		}
+		s.Sessions.Mark(userID, "totp_enroll", false)
+		s.Renew_session(c)
+		render_self_info(c, "两步验证已启用！请妥善保存以下恢复码，每个恢复码只能使用一次", gin.H{
+			"recovery_codes": codes,
+		})
+	})
+	r.POST("/totp_disable", s.Midware_Auth, s.Authorities(0b001111), func(c *gin.Context) {
+		msg := "两步验证已关闭"
+		if err := totp_disable(s, c.GetString("userID"), strings.TrimSpace(c.PostForm("code"))); err != nil {
+			msg = "关闭失败：" + err.Error()
+		}
+		render_self_info(c, msg, gin.H{})
+	})
+	r.POST("/login_totp", func(c *gin.Context) { login_totp(s, c) })
+
+	r.POST("/create_api_token", s.Midware_Auth, s.Authorities(0b111111), func(c *gin.Context) {
+		days, _ := strconv.ParseInt(c.PostForm("days"), 10, 64)
+		token, err := create_api_token(s, c.GetString("userID"), c.PostForm("name"), c.PostFormArray("scopes"), days)
+		if err != nil {
+			render_self_info(c, "创建失败："+err.Error(), gin.H{})
+			return
+		}
+		render_self_info(c, "令牌已创建！请立即复制保存，离开本页面后将无法再次查看", gin.H{
+			"new_token": token,
+		})
+	})
+	r.POST("/revoke_api_token", s.Midware_Auth, s.Authorities(0b111111), func(c *gin.Context) {
+		tokenID, _ := strconv.ParseInt(c.PostForm("tokenID"), 10, 64)
+		msg := "令牌已撤销"
+		if err := revoke_api_token(s, c.GetString("userID"), tokenID); err != nil {
+			msg = "撤销失败：" + err.Error()
+		}
+		render_self_info(c, msg, gin.H{})
+	})
+
+	r.GET("/forgot_passwd.html", func(c *gin.Context) {
+		c.HTML(http.StatusOK, "forgot_passwd.html", gin.H{
+			"msg": "",
+		})
+	})
+	r.POST("/forgot_passwd", func(c *gin.Context) {
+		// 无论用户是否存在、是否绑定邮箱，均返回相同提示，避免泄露账号信息
+		login := c.PostForm("login")
+		if len(s.Query(fmt.Sprintf("SELECT * FROM user WHERE userID=%s;", server.Join_strs([]string{login})))) > 0 {
+			send_reset_mail(s, login)
+		}
+		c.HTML(http.StatusOK, "forgot_passwd.html", gin.H{
+			"msg": "若该用户已绑定邮箱，密码重置链接已发送，请查收。",
+		})
+	})
+	r.GET("/reset_passwd.html", func(c *gin.Context) {
+		token := c.Query("token")
+		msg := ""
+		if _, ok := check_reset_token(s, token); !ok {
+			msg = "链接无效或已过期"
+		}
+		c.HTML(http.StatusOK, "reset_passwd.html", gin.H{
+			"msg":   msg,
+			"token": token,
+		})
+	})
+	r.POST("/reset_passwd", func(c *gin.Context) {
+		token := c.PostForm("token")
+		if err := reset_passwd(s, token, c.PostForm("new_passwd")); err != nil {
+			c.HTML(http.StatusOK, "reset_passwd.html", gin.H{
+				"msg":   "重置失败：" + err.Error(),
+				"token": token,
+			})
+			return
+		}
+		c.HTML(http.StatusOK, "login.html", gin.H{
+			"msg": "密码重置成功，请重新登录",
+		})
+	})
+}
@@ -0,0 +1,86 @@
+package auth_test
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"Gin-ZJUST/apptest"
+	"Gin-ZJUST/server"
+)
+
+func TestLoginEachAccountType(t *testing.T) {
+	s := apptest.New_server(t)
+	for _, userID := range []string{"root", "school", "unit", "collegeA", "branchA", "stuA"} {
+		t.Run(userID, func(t *testing.T) {
+			c := apptest.Login(t, s, userID)
+			apptest.Expect_body(t, c.Get("/home.html"), "Welcome, "+userID)
+			c.Get("/logout")
+			apptest.Expect_body(t, c.Get("/home.html"), "请登录后访问")
+		})
+	}
+
+	c := apptest.Anon(t, s)
+	apptest.Expect_body(t, c.Post("/login", url.Values{"login": {"stuA"}, "pass": {"wrong"}}), "密码错误")
+	apptest.Expect_body(t, c.Post("/login", url.Values{"login": {"nobody"}, "pass": {"pw"}}), "用户不存在")
+	apptest.Expect_body(t, c.Get("/home.html"), "请登录后访问")
+}
+
+func with_session(t *testing.T, s *server.Server, id string) *apptest.Client {
+	// 使用指定SessionID的另一个浏览器标签页
+	return &apptest.Client{T: t, S: s, Cookies: map[string]*http.Cookie{"SessionID": {Name: "SessionID", Value: id}}}
+}
+
+func TestSessionRotation(t *testing.T) {
+	// 定期更换：超过间隔后的请求下发新的SessionID，旧的SessionID在宽限期内仍然有效
+	s := apptest.New_server(t, func(c *server.Config) {
+		c.Session.Rotate = 1
+		c.Session.Grace = 1
+	})
+	c := apptest.Login(t, s, "root")
+	old := c.Cookies["SessionID"].Value
+	if len(old) != 32 {
+		t.Fatalf("SessionID 长度有误：%s", old)
+	}
+	time.Sleep(1100 * time.Millisecond)
+	apptest.Expect_body(t, c.Get("/home.html"), "Welcome, root")
+	if c.Cookies["SessionID"].Value == old {
+		t.Fatal("超过更换间隔后SessionID未更换")
+	}
+	tab := with_session(t, s, old)
+	apptest.Expect_body(t, tab.Get("/home.html"), "Welcome, root")
+	if tab.Cookies["SessionID"].Value != c.Cookies["SessionID"].Value {
+		t.Fatal("宽限期内使用旧SessionID的请求应改用新的SessionID，而不是再次更换")
+	}
+	time.Sleep(2 * time.Second)
+	apptest.Expect_body(t, with_session(t, s, old).Get("/home.html"), "登录已过期")
+	apptest.Expect_body(t, c.Get("/home.html"), "Welcome, root")
+
+	// 其他管理员修改权限后，受委派的管理员在下一次请求时更换SessionID
+	s = apptest.New_server(t, func(c *server.Config) { c.DefaultPasswd = "pw" })
+	admin := apptest.Login(t, s, "collegeA")
+	apptest.Expect_body(t, admin.Post("/invite_admin", url.Values{"name": {"secretary"}, "permission": {fmt.Sprint(server.Perm_audit_basic)}}), "添加成功")
+	secretary := apptest.Login(t, s, "secretary")
+	old = secretary.Cookies["SessionID"].Value
+	apptest.Expect_body(t, secretary.Get("/home.html"), "Welcome, secretary")
+	if secretary.Cookies["SessionID"].Value != old {
+		t.Fatal("权限未变化时SessionID不应更换")
+	}
+	apptest.Expect_body(t, admin.Post("/set_admin_permission", url.Values{"userID": {"secretary"}, "permission": {fmt.Sprint(server.Perm_check_student_info)}}), "修改成功")
+	apptest.Expect_body(t, secretary.Get("/home.html"), "Welcome, secretary")
+	if secretary.Cookies["SessionID"].Value == old {
+		t.Fatal("权限变化后SessionID未更换")
+	}
+
+	// 修改密码后旧的SessionID立即失效，当前标签页继续使用新的SessionID
+	stu := apptest.Login(t, s, "stuA")
+	old = stu.Cookies["SessionID"].Value
+	apptest.Expect_body(t, stu.Post("/change_passwd", url.Values{"new_passwd": {"pw2"}}), "修改成功")
+	if stu.Cookies["SessionID"].Value == old {
+		t.Fatal("修改密码后SessionID未更换")
+	}
+	apptest.Expect_body(t, with_session(t, s, old).Get("/home.html"), "登录已过期")
+	apptest.Expect_body(t, stu.Get("/home.html"), "Welcome, stuA")
+}
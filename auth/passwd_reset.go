@@ -0,0 +1,105 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"net/mail"
+	"net/url"
+	"time"
+
+	"Gin-ZJUST/server"
+)
+
+func user_email(s *server.Server, userID string) string {
+	// 查询用户绑定的邮箱，未绑定时返回空字符串
+	res := s.Query(fmt.Sprintf("SELECT email FROM user_email WHERE userID=%s;", server.Join_strs([]string{userID})))
+	if len(res) == 0 {
+		return ""
+	}
+	return res[0]["email"].(string)
+}
+
+var err_bad_email = errors.New("邮箱格式不正确")
+
+func set_user_email(s *server.Server, userID string, email string) error {
+	// 只保存解析得到的地址部分，拒绝无法解析的地址以免写入邮件头
+	addr, err := mail.ParseAddress(email)
+	if err != nil {
+		return err_bad_email
+	}
+	_, err = s.DB.Exec("INSERT OR REPLACE INTO user_email VALUES(?,?);", userID, addr.Address)
+	return err
+}
+
+func send_reset_mail(s *server.Server, userID string) error {
+	// 生成一次性密码重置令牌并发送到用户绑定的邮箱
+	email := user_email(s, userID)
+	if email == "" {
+		return fmt.Errorf("用户未绑定邮箱")
+	}
+	token := server.Produce_token()
+	valid := s.Config.Session.ResetValid
+	if _, err := s.DB.Exec("INSERT INTO passwd_reset VALUES(?,?,?,0);", token, userID, time.Now().Unix()+valid); err != nil {
+		return err
+	}
+	link := s.Config.Public_link("/reset_passwd.html?token=" + url.QueryEscape(token))
+	body := fmt.Sprintf("%s，您好：\r\n\r\n请在 %d 分钟内访问以下链接重置密码，链接仅可使用一次：\r\n%s\r\n\r\n如非本人操作，请忽略本邮件。", userID, valid/60, link)
+	return s.Mailer.Send(email, "素拓网密码重置", body)
+}
+
+func check_reset_token(s *server.Server, token string) (string, bool) {
+	// 校验密码重置令牌，有效时返回对应用户名
+	res := s.Query(fmt.Sprintf("SELECT * FROM passwd_reset WHERE token=%s;", server.Join_strs([]string{token})))
+	if len(res) == 0 || res[0]["used"].(int64) != 0 || time.Now().Unix() > res[0]["due"].(int64) {
+		return "", false
+	}
+	return res[0]["userID"].(string), true
+}
+
+func reset_passwd(s *server.Server, token string, new_passwd string) error {
+	// 使用令牌重置密码，令牌随即失效，并使该用户已有的登录状态失效
+	userID, ok := check_reset_token(s, token)
+	if !ok {
+		return fmt.Errorf("链接无效或已过期")
+	}
+	if new_passwd == "" {
+		return fmt.Errorf("密码不能为空")
+	}
+	tx, err := s.DB.Beginx()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	res, err := tx.Exec("UPDATE passwd_reset SET used=1 WHERE token=? AND used=0;", token)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		// 令牌已被并发的请求使用
+		return fmt.Errorf("链接无效或已过期")
+	}
+	if _, err = tx.Exec("UPDATE user SET passwd=? WHERE userID=?;", new_passwd, userID); err != nil {
+		return err
+	}
+	if err = tx.Commit(); err != nil {
+		return err
+	}
+	s.Sessions.Logout(userID)
+	return nil
+}
+
+func Admin_reset_passwd(s *server.Server, userID string) (string, error) {
+	// 管理员为管辖范围内的用户重置密码：已绑定邮箱的发送重置邮件，否则恢复为默认密码
+	if user_email(s, userID) != "" {
+		if err := send_reset_mail(s, userID); err != nil {
+			return "", err
+		}
+		return "已向该用户的邮箱发送密码重置链接", nil
+	}
+	default_passwd := s.Config.DefaultPasswd
+	if !s.Exec(fmt.Sprintf("UPDATE user SET passwd=%s WHERE userID=%s;", server.Join_strs([]string{default_passwd}), server.Join_strs([]string{userID}))) {
+		return "", fmt.Errorf("重置失败")
+	}
+	s.Sessions.Logout(userID)
+	return "该用户未绑定邮箱，密码已恢复为默认密码" + default_passwd, nil
+}
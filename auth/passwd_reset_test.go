@@ -0,0 +1,145 @@
+package auth_test
+
+import (
+	"bufio"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"Gin-ZJUST/apptest"
+	"Gin-ZJUST/server"
+)
+
+func new_fake_smtp(t *testing.T) (string, chan string) {
+	// 最简单的 SMTP 服务器，收到的每封邮件（DATA 部分）写入通道
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+	mails := make(chan string, 10)
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				r := bufio.NewReader(conn)
+				conn.Write([]byte("220 localhost ESMTP\r\n"))
+				for {
+					line, err := r.ReadString('\n')
+					if err != nil {
+						return
+					}
+					cmd := strings.ToUpper(strings.TrimSpace(line))
+					switch {
+					case strings.HasPrefix(cmd, "EHLO"), strings.HasPrefix(cmd, "HELO"):
+						conn.Write([]byte("250 localhost\r\n"))
+					case cmd == "DATA":
+						conn.Write([]byte("354 end with .\r\n"))
+						data := []string{}
+						for {
+							line, err := r.ReadString('\n')
+							if err != nil {
+								return
+							}
+							if line == ".\r\n" {
+								break
+							}
+							data = append(data, line)
+						}
+						mails <- strings.Join(data, "")
+						conn.Write([]byte("250 OK\r\n"))
+					case cmd == "QUIT":
+						conn.Write([]byte("221 bye\r\n"))
+						return
+					default:
+						conn.Write([]byte("250 OK\r\n"))
+					}
+				}
+			}()
+		}
+	}()
+	return l.Addr().String(), mails
+}
+
+func TestPasswdResetMail(t *testing.T) {
+	addr, mails := new_fake_smtp(t)
+	s := apptest.New_server(t, func(c *server.Config) {
+		c.Mail.Addr = addr
+		c.PublicURL = "https://sutuo.example.edu/"
+	})
+	s.Exec("INSERT INTO user_email VALUES('stuA','stuA@example.edu');")
+
+	// 请求中伪造的 Host 不影响邮件中的链接
+	c := apptest.Anon(t, s)
+	req := httptest.NewRequest(http.MethodPost, "/forgot_passwd", strings.NewReader(url.Values{"login": {"stuA"}}.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Host = "evil.example"
+	apptest.Expect_body(t, c.Do(req), "密码重置链接已发送")
+	var mail string
+	select {
+	case mail = <-mails:
+	default:
+		t.Fatal("没有收到密码重置邮件")
+	}
+	if !strings.Contains(mail, "To: stuA@example.edu") || strings.Contains(mail, "evil.example") {
+		t.Fatalf("邮件内容有误：%s", mail)
+	}
+	prefix := "https://sutuo.example.edu/reset_passwd.html?token="
+	i := strings.Index(mail, prefix)
+	if i < 0 {
+		t.Fatalf("邮件中没有重置链接：%s", mail)
+	}
+	token, _, _ := strings.Cut(mail[i+len(prefix):], "\r\n")
+
+	// 使用令牌重置密码后可用新密码登录，令牌不能再次使用
+	apptest.Expect_body(t, c.Get("/reset_passwd.html?token="+token), `name="token" value="`+token+`"`)
+	apptest.Expect_body(t, c.Post("/reset_passwd", url.Values{"token": {token}, "new_passwd": {"new-pw"}}), "密码重置成功")
+	apptest.Expect_body(t, c.Post("/reset_passwd", url.Values{"token": {token}, "new_passwd": {"again"}}), "链接无效或已过期")
+	if w := c.Post("/login", url.Values{"login": {"stuA"}, "pass": {"new-pw"}}); w.Code != http.StatusTemporaryRedirect {
+		t.Fatalf("新密码登录失败：%d %s", w.Code, w.Body.String())
+	}
+	if w := apptest.Anon(t, s).Post("/login", url.Values{"login": {"stuA"}, "pass": {"pw"}}); w.Code == http.StatusTemporaryRedirect {
+		t.Fatal("旧密码仍可登录")
+	}
+}
+
+func TestChangeEmail(t *testing.T) {
+	addr, mails := new_fake_smtp(t)
+	s := apptest.New_server(t, func(c *server.Config) { c.Mail.Addr = addr })
+	c := apptest.Login(t, s, "collegeA")
+
+	// 无法解析的地址不能绑定，带显示名的地址只保存地址部分
+	for _, email := range []string{"", "not-an-email", "a@example.edu\r\nBcc: evil@example.edu"} {
+		apptest.Expect_body(t, c.Post("/change_email", url.Values{"email": {email}}), "修改失败：邮箱格式不正确")
+	}
+	if len(s.Query("SELECT * FROM user_email WHERE userID='collegeA';")) != 0 {
+		t.Fatal("格式不正确的邮箱被保存")
+	}
+	apptest.Expect_body(t, c.Post("/change_email", url.Values{"email": {"学院A <collegeA@example.edu>"}}), "修改成功！")
+	if res := s.Query("SELECT email FROM user_email WHERE userID='collegeA';"); len(res) != 1 || res[0]["email"] != "collegeA@example.edu" {
+		t.Fatalf("保存的邮箱有误：%v", res)
+	}
+
+	// 邮件主题按 RFC 2047 编码
+	apptest.Expect_body(t, apptest.Anon(t, s).Post("/forgot_passwd", url.Values{"login": {"collegeA"}}), "密码重置链接已发送")
+	mail := <-mails
+	if !strings.Contains(mail, "Subject: =?UTF-8?b?") || strings.Contains(mail, "Subject: 素拓网") {
+		t.Fatalf("邮件主题未编码：%s", mail)
+	}
+
+	// 删除账号时一并删除绑定的邮箱与密码重置令牌
+	root := apptest.Login(t, s, "root")
+	apptest.Expect_body(t, root.Get("/delete_admin?userID=collegeA"), "删除成功！")
+	for _, table := range []string{"user_email", "passwd_reset"} {
+		if len(s.Query("SELECT * FROM "+table+" WHERE userID='collegeA';")) != 0 {
+			t.Fatalf("删除账号后 %s 中仍有记录", table)
+		}
+	}
+}
@@ -0,0 +1,271 @@
+package auth
+
+import (
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"Gin-ZJUST/server"
+
+	"github.com/gin-gonic/gin"
+)
+
+const sso_cookie = "sso_state" // 发起统一身份认证时生成的 state 和 nonce，回调时与返回的参数比对，将认证结果绑定到发起登录的浏览器
+
+const sso_valid = 600 // 发起统一身份认证后完成登录的最长时间（秒）
+
+func sso_callback_url(s *server.Server, path string) string {
+	return s.Config.Public_link(path)
+}
+
+func sso_start(s *server.Server, c *gin.Context) (string, string) {
+	// 生成 state 和 nonce 并写入短期 Cookie。从认证服务器跳转回来属于跨站导航，SameSite=Strict 的 Cookie 不会被发送，因此至少使用 Lax
+	state, nonce := server.Produce_token(), server.Produce_token()
+	mode := http.SameSiteLaxMode
+	if server.Samesite_modes[strings.ToLower(s.Config.Cookie.SameSite)] == http.SameSiteNoneMode {
+		mode = http.SameSiteNoneMode
+	}
+	c.SetSameSite(mode)
+	c.SetCookie(sso_cookie, state+"."+nonce, sso_valid, "/sso/", s.Config.Cookie.Domain, s.Config.Cookie.Secure, true)
+	return state, nonce
+}
+
+func sso_finish(s *server.Server, c *gin.Context, state string) (string, bool) {
+	// 校验回调中的 state 与本浏览器 Cookie 中的一致，返回 nonce；Cookie 随即删除，同一 state 不能重复使用
+	value, err := c.Cookie(sso_cookie)
+	c.SetCookie(sso_cookie, "", -1, "/sso/", s.Config.Cookie.Domain, s.Config.Cookie.Secure, true)
+	if err != nil {
+		return "", false
+	}
+	want, nonce, ok := strings.Cut(value, ".")
+	if !ok || state == "" || subtle.ConstantTimeCompare([]byte(state), []byte(want)) != 1 {
+		return "", false
+	}
+	return nonce, true
+}
+
+func sso_fail(c *gin.Context, msg string) {
+	c.HTML(http.StatusOK, "login.html", gin.H{
+		"msg": msg,
+	})
+}
+
+var sso_client = &http.Client{Timeout: 10 * time.Second} // 访问认证服务器的客户端，认证服务器无响应时不会一直占用请求
+
+func sso_login(s *server.Server, c *gin.Context, userID string) {
+	// 统一身份认证通过后登录：账号不存在时按配置自动创建为默认团支部的学生
+	if userID == "" {
+		sso_fail(c, "统一身份认证未返回学号")
+		return
+	}
+	user := s.Query(fmt.Sprintf("SELECT * FROM user WHERE userID=%s;", server.Join_strs([]string{userID})))
+	if len(user) > 0 && user[0]["account_type"].(int64) != 5 {
+		// 统一身份认证只返回学号，管理员账号只能使用密码（及两步验证）登录
+		sso_fail(c, "统一身份认证仅限学生账号登录，管理员请使用密码登录")
+		return
+	}
+	if len(user) == 0 {
+		if s.Config.SSO.DefaultBranch == 0 {
+			sso_fail(c, "用户不存在！请联系管理员。")
+			return
+		}
+		// 启动时已校验默认团支部，运行中被删除或调整时不再自动创建
+		if err := s.Check_sso_branch(); err != nil {
+			s.Req_log(c).Error("自动创建账号失败", "error", err)
+			sso_fail(c, "用户不存在！请联系管理员。")
+			return
+		}
+		// 自动创建的账号使用随机密码，只能通过统一身份认证或重置密码登录
+		if _, err := s.DB.Exec("INSERT INTO user VALUES(?,?,5,?);", userID, server.Produce_token(), s.Config.SSO.DefaultBranch); err != nil {
+			sso_fail(c, "创建账号失败")
+			return
+		}
+	}
+	finish_login(s, c, userID, http.StatusFound)
+}
+
+func oidc_login(s *server.Server, c *gin.Context) {
+	state, nonce := sso_start(s, c)
+	params := url.Values{
+		"response_type": {"code"},
+		"client_id":     {s.Config.SSO.OIDCClientID},
+		"redirect_uri":  {sso_callback_url(s, "/sso/oidc/callback")},
+		"scope":         {"openid profile"},
+		"state":         {state},
+		"nonce":         {nonce},
+	}
+	c.Redirect(http.StatusFound, s.Config.SSO.OIDCAuthURL+"?"+params.Encode())
+}
+
+func oidc_callback(s *server.Server, c *gin.Context) {
+	// 授权码模式：校验 state，使用授权码换取令牌并校验 ID Token 中的 nonce，再通过用户信息接口取得学号
+	nonce, ok := sso_finish(s, c, c.Query("state"))
+	if !ok || c.Query("code") == "" {
+		sso_fail(c, "统一身份认证失败，请重试")
+		return
+	}
+	userID, err := oidc_user(s, c.Query("code"), sso_callback_url(s, "/sso/oidc/callback"), nonce)
+	if err != nil {
+		sso_fail(c, "统一身份认证失败："+err.Error())
+		return
+	}
+	sso_login(s, c, userID)
+}
+
+func id_token_claims(id_token string) (map[string]any, error) {
+	// ID Token 由服务器直接从令牌接口取得，按 OIDC 规范可由 TLS 保证来源，此处只解析载荷
+	parts := strings.Split(id_token, ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("ID Token 格式有误")
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(parts[1], "="))
+	if err != nil {
+		return nil, fmt.Errorf("ID Token 格式有误")
+	}
+	claims := map[string]any{}
+	if err = json.Unmarshal(payload, &claims); err != nil {
+		return nil, fmt.Errorf("ID Token 格式有误")
+	}
+	return claims, nil
+}
+
+func audience_has(aud any, clientID string) bool {
+	switch aud := aud.(type) {
+	case string:
+		return aud == clientID
+	case []any:
+		for _, a := range aud {
+			if a == clientID {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func oidc_user(s *server.Server, code string, redirect_uri string, nonce string) (string, error) {
+	resp, err := sso_client.PostForm(s.Config.SSO.OIDCTokenURL, url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {redirect_uri},
+		"client_id":     {s.Config.SSO.OIDCClientID},
+		"client_secret": {s.Config.SSO.OIDCClientSecret},
+	})
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	token := map[string]any{}
+	if err = json.NewDecoder(resp.Body).Decode(&token); err != nil || resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("获取令牌失败")
+	}
+	access_token, _ := token["access_token"].(string)
+	id_token, _ := token["id_token"].(string)
+	claims, err := id_token_claims(id_token)
+	if err != nil {
+		return "", err
+	}
+	if claims["nonce"] != nonce || !audience_has(claims["aud"], s.Config.SSO.OIDCClientID) {
+		return "", fmt.Errorf("ID Token 校验失败")
+	}
+	if exp, _ := claims["exp"].(float64); int64(exp) < time.Now().Unix() {
+		return "", fmt.Errorf("ID Token 已过期")
+	}
+
+	req, _ := http.NewRequest(http.MethodGet, s.Config.SSO.OIDCUserinfoURL, nil)
+	req.Header.Set("Authorization", "Bearer "+access_token)
+	resp, err = sso_client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	info := map[string]any{}
+	if err = json.NewDecoder(resp.Body).Decode(&info); err != nil || resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("获取用户信息失败")
+	}
+	switch claim := info[s.Config.SSO.OIDCClaim].(type) {
+	case string:
+		return claim, nil
+	case float64:
+		return strconv.FormatFloat(claim, 'f', -1, 64), nil
+	}
+	return "", fmt.Errorf("用户信息中缺少学号")
+}
+
+func cas_service(s *server.Server, state string) string {
+	// CAS 没有 state 参数，将 state 放在回调地址中，票据只对同一回调地址有效
+	return sso_callback_url(s, "/sso/cas/callback?state="+url.QueryEscape(state))
+}
+
+func cas_login(s *server.Server, c *gin.Context) {
+	state, _ := sso_start(s, c)
+	c.Redirect(http.StatusFound, s.Config.SSO.CASURL+"/login?service="+url.QueryEscape(cas_service(s, state)))
+}
+
+type cas_response struct {
+	Success *struct {
+		User       string `xml:"user"`
+		Attributes struct {
+			Values []struct {
+				XMLName xml.Name
+				Value   string `xml:",chardata"`
+			} `xml:",any"`
+		} `xml:"attributes"`
+	} `xml:"authenticationSuccess"`
+	Failure *struct {
+		Code    string `xml:"code,attr"`
+		Message string `xml:",chardata"`
+	} `xml:"authenticationFailure"`
+}
+
+func cas_callback(s *server.Server, c *gin.Context) {
+	state := c.Query("state")
+	if _, ok := sso_finish(s, c, state); !ok {
+		sso_fail(c, "统一身份认证失败，请重试")
+		return
+	}
+	userID, err := cas_user(s, c.Query("ticket"), cas_service(s, state))
+	if err != nil {
+		sso_fail(c, "统一身份认证失败："+err.Error())
+		return
+	}
+	sso_login(s, c, userID)
+}
+
+func cas_user(s *server.Server, ticket string, service string) (string, error) {
+	// 通过 CAS 3.0 serviceValidate 接口校验票据
+	if ticket == "" {
+		return "", fmt.Errorf("缺少票据")
+	}
+	resp, err := sso_client.Get(s.Config.SSO.CASURL + "/p3/serviceValidate?service=" + url.QueryEscape(service) + "&ticket=" + url.QueryEscape(ticket))
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	res := cas_response{}
+	if err = xml.NewDecoder(resp.Body).Decode(&res); err != nil {
+		return "", fmt.Errorf("票据校验失败")
+	}
+	if res.Success == nil {
+		if res.Failure != nil {
+			return "", fmt.Errorf("%s", strings.TrimSpace(res.Failure.Message))
+		}
+		return "", fmt.Errorf("票据校验失败")
+	}
+	if s.Config.SSO.CASClaim == "" {
+		return strings.TrimSpace(res.Success.User), nil
+	}
+	for _, attr := range res.Success.Attributes.Values {
+		if attr.XMLName.Local == s.Config.SSO.CASClaim {
+			return strings.TrimSpace(attr.Value), nil
+		}
+	}
+	return "", fmt.Errorf("票据中缺少学号")
+}
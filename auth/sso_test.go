@@ -0,0 +1,163 @@
+package auth_test
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"Gin-ZJUST/apptest"
+	"Gin-ZJUST/server"
+)
+
+type fake_idp struct {
+	mu    sync.Mutex
+	codes map[string]map[string]any // 授权码 to ID Token 载荷与用户信息
+}
+
+func new_fake_idp(t *testing.T) (*httptest.Server, *fake_idp) {
+	// 模拟 OIDC 认证服务器的令牌接口和用户信息接口，访问令牌即授权码
+	idp := &fake_idp{codes: map[string]map[string]any{}}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		idp.mu.Lock()
+		defer idp.mu.Unlock()
+		switch r.URL.Path {
+		case "/token":
+			claims, ok := idp.codes[r.PostFormValue("code")]
+			if !ok || r.PostFormValue("client_id") != "sutuo" || r.PostFormValue("redirect_uri") != "https://sutuo.example.edu/sso/oidc/callback" {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			payload, _ := json.Marshal(claims)
+			enc := base64.RawURLEncoding.EncodeToString
+			json.NewEncoder(w).Encode(map[string]any{
+				"access_token": r.PostFormValue("code"),
+				"id_token":     enc([]byte(`{"alg":"RS256"}`)) + "." + enc(payload) + ".sig",
+			})
+		case "/userinfo":
+			claims, ok := idp.codes[strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")]
+			if !ok {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			json.NewEncoder(w).Encode(map[string]any{"student_number": claims["sub"]})
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	t.Cleanup(ts.Close)
+	return ts, idp
+}
+
+func (idp *fake_idp) grant(code string, userID string, nonce string) {
+	idp.mu.Lock()
+	defer idp.mu.Unlock()
+	idp.codes[code] = map[string]any{"sub": userID, "nonce": nonce, "aud": "sutuo", "exp": time.Now().Unix() + 60}
+}
+
+func sso_start(t *testing.T, c *apptest.Client) (string, string) {
+	// 发起统一身份认证，返回跳转到认证服务器的 state 和 nonce
+	w := c.Get("/sso/oidc/login")
+	loc, err := url.Parse(w.Header().Get("Location"))
+	if w.Code != http.StatusFound || err != nil || c.Cookies["sso_state"] == nil {
+		t.Fatalf("发起统一身份认证失败：%d %v", w.Code, w.Header())
+	}
+	if loc.Query().Get("redirect_uri") != "https://sutuo.example.edu/sso/oidc/callback" {
+		t.Fatalf("回调地址有误：%s", loc)
+	}
+	return loc.Query().Get("state"), loc.Query().Get("nonce")
+}
+
+func TestSSOLogin(t *testing.T) {
+	ts, idp := new_fake_idp(t)
+	s := apptest.New_server(t, func(c *server.Config) {
+		c.PublicURL = "https://sutuo.example.edu"
+		c.SSO.OIDCAuthURL = ts.URL + "/authorize"
+		c.SSO.OIDCTokenURL = ts.URL + "/token"
+		c.SSO.OIDCUserinfoURL = ts.URL + "/userinfo"
+		c.SSO.OIDCClientID = "sutuo"
+		c.SSO.OIDCClientSecret = "secret"
+		c.SSO.DefaultBranch = 4
+	})
+	new_client := func() *apptest.Client { return apptest.Anon(t, s) }
+
+	// 首次登录的学生自动创建到默认团支部
+	c := new_client()
+	req := httptest.NewRequest(http.MethodGet, "/sso/oidc/login", nil)
+	req.Host = "evil.example"
+	if w := c.Do(req); strings.Contains(w.Header().Get("Location"), "evil.example") {
+		t.Fatalf("回调地址使用了请求中的 Host：%s", w.Header().Get("Location"))
+	}
+	state, nonce := sso_start(t, c)
+	idp.grant("code-new", "3200001", nonce)
+	callback := "/sso/oidc/callback?code=code-new&state=" + url.QueryEscape(state)
+	if w := c.Get(callback); w.Code != http.StatusFound || w.Header().Get("Location") != "/home.html" || c.Cookies["SessionID"] == nil {
+		t.Fatalf("统一身份认证登录失败：%d %s", w.Code, w.Body.String())
+	}
+	if user, err := s.Query_one("SELECT * FROM user WHERE userID='3200001';"); err != nil || user["account_type"] != int64(5) || user["belonging_org"] != int64(4) {
+		t.Fatalf("没有自动创建学生账号：%v %v", user, err)
+	}
+	apptest.Expect_body(t, c.Get("/home.html"), "Welcome, 3200001")
+
+	// state 只能使用一次
+	apptest.Expect_body(t, c.Get(callback), "统一身份认证失败")
+
+	// 其他浏览器发起的认证结果不能在本浏览器完成登录（登录 CSRF）
+	attacker := new_client()
+	state, nonce = sso_start(t, attacker)
+	idp.grant("code-attacker", "3200002", nonce)
+	victim := new_client()
+	sso_start(t, victim)
+	apptest.Expect_body(t, victim.Get("/sso/oidc/callback?code=code-attacker&state="+url.QueryEscape(state)), "统一身份认证失败")
+	if victim.Cookies["SessionID"] != nil {
+		t.Fatal("登录 CSRF 未被阻止")
+	}
+
+	// ID Token 中的 nonce 与本次认证不符
+	c = new_client()
+	state, _ = sso_start(t, c)
+	idp.grant("code-nonce", "3200003", "other")
+	apptest.Expect_body(t, c.Get("/sso/oidc/callback?code=code-nonce&state="+url.QueryEscape(state)), "ID Token 校验失败")
+
+	// 管理员账号不能通过统一身份认证登录
+	c = new_client()
+	state, nonce = sso_start(t, c)
+	idp.grant("code-admin", "collegeA", nonce)
+	apptest.Expect_body(t, c.Get("/sso/oidc/callback?code=code-admin&state="+url.QueryEscape(state)), "仅限学生账号")
+	if c.Cookies["SessionID"] != nil {
+		t.Fatal("管理员通过统一身份认证登录")
+	}
+
+	// 已有学生账号可直接登录
+	c = new_client()
+	state, nonce = sso_start(t, c)
+	idp.grant("code-stu", "stuA", nonce)
+	if w := c.Get("/sso/oidc/callback?code=code-stu&state=" + url.QueryEscape(state)); w.Code != http.StatusFound || c.Cookies["SessionID"] == nil {
+		t.Fatalf("学生统一身份认证登录失败：%d %s", w.Code, w.Body.String())
+	}
+
+	// 默认团支部须存在且为团支部，否则启动时报错、运行中不自动创建账号
+	if err := s.Check_sso_branch(); err != nil {
+		t.Fatalf("默认团支部校验失败：%v", err)
+	}
+	for _, orgID := range []int64{3, 99} {
+		s.Config.SSO.DefaultBranch = orgID
+		if s.Check_sso_branch() == nil {
+			t.Fatalf("orgID=%d 不是团支部，应校验失败", orgID)
+		}
+		c = new_client()
+		state, nonce = sso_start(t, c)
+		code := fmt.Sprintf("code-branch-%d", orgID)
+		idp.grant(code, "3200004", nonce)
+		apptest.Expect_body(t, c.Get("/sso/oidc/callback?code="+code+"&state="+url.QueryEscape(state)), "用户不存在！")
+		if len(s.Query("SELECT * FROM user WHERE userID='3200004';")) != 0 {
+			t.Fatalf("默认团支部为 %d 时不应自动创建账号", orgID)
+		}
+	}
+}
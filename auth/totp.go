@@ -0,0 +1,222 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/base32"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"Gin-ZJUST/server"
+
+	"github.com/gin-gonic/gin"
+)
+
+var totp_step int64 = 30 // 动态口令时间步长（秒）
+
+const totp_max_failures = 5 // 输错动态口令达到该次数后需重新输入密码登录
+
+func totp_account(account_type int64) bool {
+	// 超级管理员、校级、单位、学院管理员可启用两步验证
+	return account_type >= 0 && account_type <= 3
+}
+
+func totp_code(secret string, step int64) string {
+	// RFC 6238：HMAC-SHA1，6位数字
+	key, err := base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(secret)
+	if err != nil {
+		return ""
+	}
+	msg := make([]byte, 8)
+	binary.BigEndian.PutUint64(msg, uint64(step))
+	mac := hmac.New(sha1.New, key)
+	mac.Write(msg)
+	sum := mac.Sum(nil)
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	return fmt.Sprintf("%06d", value%1000000)
+}
+
+func totp_info(s *server.Server, userID string) (map[string]any, bool) {
+	res := s.Query(fmt.Sprintf("SELECT * FROM user_totp WHERE userID=%s;", server.Join_strs([]string{userID})))
+	if len(res) == 0 {
+		return nil, false
+	}
+	return res[0], true
+}
+
+func totp_enabled(s *server.Server, userID string) bool {
+	info, ok := totp_info(s, userID)
+	return ok && info["enabled"].(int64) == 1
+}
+
+func totp_verify(s *server.Server, userID string, code string) bool {
+	// 校验动态口令，允许前后各一个时间步的误差；已使用过的时间步不可重复使用
+	info, ok := totp_info(s, userID)
+	if !ok {
+		return false
+	}
+	now := time.Now().Unix() / totp_step
+	last := info["last_step"].(int64)
+	for _, step := range []int64{now - 1, now, now + 1} {
+		if step > last && hmac.Equal([]byte(totp_code(info["secret"].(string), step)), []byte(code)) {
+			res, err := s.DB.Exec("UPDATE user_totp SET last_step=? WHERE userID=? AND last_step<?;", step, userID, step)
+			if err != nil {
+				return false
+			}
+			n, _ := res.RowsAffected()
+			return n == 1
+		}
+	}
+	return false
+}
+
+func hash_recovery_code(code string) string {
+	sum := sha256.Sum256([]byte(strings.ToLower(strings.TrimSpace(code))))
+	return hex.EncodeToString(sum[:])
+}
+
+func totp_use_recovery_code(s *server.Server, userID string, code string) bool {
+	// 使用一次性恢复码，使用后即失效
+	info, ok := totp_info(s, userID)
+	if !ok || info["enabled"].(int64) != 1 {
+		return false
+	}
+	hashes := []string{}
+	json.Unmarshal([]byte(info["recovery"].(string)), &hashes)
+	h := hash_recovery_code(code)
+	for i, stored := range hashes {
+		if hmac.Equal([]byte(stored), []byte(h)) {
+			hashes = append(hashes[:i], hashes[i+1:]...)
+			remain, _ := json.Marshal(hashes)
+			res, err := s.DB.Exec("UPDATE user_totp SET recovery=? WHERE userID=? AND recovery=?;", string(remain), userID, info["recovery"])
+			if err != nil {
+				return false
+			}
+			// 恢复码已被并发的请求使用
+			n, _ := res.RowsAffected()
+			return n == 1
+		}
+	}
+	return false
+}
+
+func totp_begin_enroll(s *server.Server, userID string) (string, string, error) {
+	// 生成新的密钥，待输入动态口令确认后启用
+	if totp_enabled(s, userID) {
+		return "", "", fmt.Errorf("已启用两步验证")
+	}
+	key := make([]byte, 20)
+	rand.Read(key)
+	secret := base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(key)
+	if _, err := s.DB.Exec("INSERT OR REPLACE INTO user_totp VALUES(?,?,0,'[]',0);", userID, secret); err != nil {
+		return "", "", err
+	}
+	uri := fmt.Sprintf("otpauth://totp/%s:%s?secret=%s&issuer=%s", url.PathEscape("Gin-ZJUST"), url.PathEscape(userID), secret, url.QueryEscape("Gin-ZJUST"))
+	return secret, uri, nil
+}
+
+func totp_confirm_enroll(s *server.Server, userID string, code string) ([]string, error) {
+	// 校验动态口令后启用两步验证，并生成10个一次性恢复码
+	info, ok := totp_info(s, userID)
+	if !ok || info["enabled"].(int64) == 1 {
+		return nil, fmt.Errorf("请先生成密钥")
+	}
+	if !totp_verify(s, userID, code) {
+		return nil, fmt.Errorf("动态口令错误")
+	}
+	codes := []string{}
+	hashes := []string{}
+	for i := 0; i < 10; i++ {
+		b := make([]byte, 5)
+		rand.Read(b)
+		code := hex.EncodeToString(b)
+		codes = append(codes, code)
+		hashes = append(hashes, hash_recovery_code(code))
+	}
+	recovery, _ := json.Marshal(hashes)
+	if _, err := s.DB.Exec("UPDATE user_totp SET enabled=1,recovery=? WHERE userID=?;", string(recovery), userID); err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+func totp_disable(s *server.Server, userID string, code string) error {
+	if s.Config.TOTPRequired {
+		return fmt.Errorf("系统要求管理员启用两步验证")
+	}
+	if !totp_verify(s, userID, code) && !totp_use_recovery_code(s, userID, code) {
+		return fmt.Errorf("动态口令错误")
+	}
+	_, err := s.DB.Exec("DELETE FROM user_totp WHERE userID=?;", userID)
+	return err
+}
+
+func finish_login(s *server.Server, c *gin.Context, userID string, redirect_code int) {
+	// 密码或统一身份认证通过后的登录流程：启用了两步验证的管理员需再输入动态口令，
+	// 强制启用两步验证而尚未启用的管理员登录后只能访问个人信息管理页面完成设置
+	user, err := s.Query_one(fmt.Sprintf("SELECT account_type FROM user WHERE userID=%s;", server.Join_strs([]string{userID})))
+	if err != nil {
+		s.Fail(c, err)
+		return
+	}
+	account_type := user["account_type"].(int64)
+	if totp_account(account_type) && totp_enabled(s, userID) {
+		pendingID := s.Pending.Start(userID, 300)
+		s.Set_cookie(c, "TwoFactorID", pendingID, 300)
+		c.HTML(http.StatusOK, "login_totp.html", gin.H{
+			"msg": "",
+		})
+		return
+	}
+	s.Start_session(c, userID)
+	if totp_account(account_type) && s.Config.TOTPRequired {
+		s.Sessions.Mark(userID, "totp_enroll", true)
+		c.Redirect(http.StatusFound, "/manage_self_info.html")
+		return
+	}
+	c.Redirect(redirect_code, "/home.html")
+}
+
+func login_totp(s *server.Server, c *gin.Context) {
+	// 登录第二步：校验动态口令或恢复码
+	// 每次校验先取出等待中的登录，口令错误且未达到次数上限时再放回，同一登录的并发尝试不会绕过次数限制
+	pendingID, _ := c.Cookie("TwoFactorID")
+	pending, ok := s.Pending.Take(pendingID)
+	if !ok {
+		s.Set_cookie(c, "TwoFactorID", "", -1)
+		c.HTML(http.StatusOK, "login.html", gin.H{
+			"msg": "验证已过期，请重新登录",
+		})
+		return
+	}
+	userID := pending["userID"].(string)
+	code := strings.TrimSpace(c.PostForm("code"))
+	if !totp_verify(s, userID, code) && !totp_use_recovery_code(s, userID, code) {
+		failures := pending["failures"].(int) + 1
+		if failures >= totp_max_failures {
+			s.Set_cookie(c, "TwoFactorID", "", -1)
+			c.HTML(http.StatusOK, "login.html", gin.H{
+				"msg": "动态口令错误次数过多，请重新登录",
+			})
+			return
+		}
+		pending["failures"] = failures
+		s.Pending.Put(pendingID, pending)
+		c.HTML(http.StatusOK, "login_totp.html", gin.H{
+			"msg": fmt.Sprintf("动态口令错误，请重试（还可尝试 %d 次）", totp_max_failures-failures),
+		})
+		return
+	}
+	s.Set_cookie(c, "TwoFactorID", "", -1)
+	s.Start_session(c, userID)
+	c.Redirect(http.StatusFound, "/home.html")
+}
@@ -0,0 +1,105 @@
+package auth_test
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"Gin-ZJUST/apptest"
+	"Gin-ZJUST/server"
+)
+
+func totp_now(secret string, offset int64) string {
+	// 按 RFC 6238 计算当前时间步（加 offset）的动态口令，与身份验证器相同
+	key, _ := base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(secret)
+	msg := make([]byte, 8)
+	binary.BigEndian.PutUint64(msg, uint64(time.Now().Unix()/30+offset))
+	mac := hmac.New(sha1.New, key)
+	mac.Write(msg)
+	sum := mac.Sum(nil)
+	i := sum[len(sum)-1] & 0x0f
+	return fmt.Sprintf("%06d", (binary.BigEndian.Uint32(sum[i:i+4])&0x7fffffff)%1000000)
+}
+
+func TestTOTPLogin(t *testing.T) {
+	s := apptest.New_server(t, func(c *server.Config) { c.DefaultPasswd = "pw" })
+
+	// 启用：生成密钥，输入动态口令后得到恢复码
+	c := apptest.Login(t, s, "collegeA")
+	w := c.Post("/totp_enroll", nil)
+	apptest.Expect_body(t, w, "密钥：")
+	secret := strings.Fields(strings.SplitN(w.Body.String(), "密钥：", 2)[1])[0]
+	apptest.Expect_body(t, c.Post("/totp_confirm", url.Values{"code": {"000000"}}), "启用失败：动态口令错误")
+	w = c.Post("/totp_confirm", url.Values{"code": {totp_now(secret, 0)}})
+	apptest.Expect_body(t, w, "两步验证已启用")
+	recovery := strings.Fields(strings.SplitN(strings.SplitN(w.Body.String(), "恢复码：<br>", 2)[1], "已启用", 2)[0])
+	codes := []string{}
+	for _, code := range recovery {
+		if code = strings.TrimSuffix(code, "<br>"); code != "" {
+			codes = append(codes, code)
+		}
+	}
+	if len(codes) != 10 {
+		t.Fatalf("恢复码数量有误：%v", codes)
+	}
+
+	start := func() *apptest.Client {
+		// 输入密码后需输入动态口令，尚未登录
+		c := apptest.Anon(t, s)
+		apptest.Expect_body(t, c.Post("/login", url.Values{"login": {"collegeA"}, "pass": {"pw"}}), "请输入身份验证器中的动态口令")
+		if c.Cookies["SessionID"] != nil || c.Cookies["TwoFactorID"] == nil {
+			t.Fatal("输入密码后即已登录")
+		}
+		return c
+	}
+
+	// 使用动态口令登录；启用时已使用当前时间步，登录使用下一个时间步的口令
+	c = start()
+	code := totp_now(secret, 1)
+	if w := c.Post("/login_totp", url.Values{"code": {code}}); w.Code != http.StatusFound || c.Cookies["SessionID"] == nil {
+		t.Fatalf("动态口令登录失败：%d %s", w.Code, w.Body.String())
+	}
+	apptest.Expect_body(t, c.Get("/home.html"), "Welcome, collegeA")
+
+	// 同一动态口令不能再次使用
+	c = start()
+	apptest.Expect_body(t, c.Post("/login_totp", url.Values{"code": {code}}), "动态口令错误")
+
+	// 恢复码只能使用一次
+	if w := c.Post("/login_totp", url.Values{"code": {codes[0]}}); w.Code != http.StatusFound || c.Cookies["SessionID"] == nil {
+		t.Fatalf("恢复码登录失败：%d %s", w.Code, w.Body.String())
+	}
+	c = start()
+	apptest.Expect_body(t, c.Post("/login_totp", url.Values{"code": {codes[0]}}), "还可尝试 4 次")
+
+	// 输错 5 次后需重新输入密码，正确的恢复码也不再接受
+	for i := 3; i > 0; i-- {
+		apptest.Expect_body(t, c.Post("/login_totp", url.Values{"code": {"000000"}}), fmt.Sprintf("还可尝试 %d 次", i))
+	}
+	apptest.Expect_body(t, c.Post("/login_totp", url.Values{"code": {"000000"}}), "动态口令错误次数过多，请重新登录")
+	apptest.Expect_body(t, c.Post("/login_totp", url.Values{"code": {codes[1]}}), "验证已过期，请重新登录")
+	if c.Cookies["SessionID"] != nil {
+		t.Fatal("输错次数过多后仍可登录")
+	}
+
+	// 等待动态口令的登录保存在各自的 Server 中，不会被其他 Server 接受
+	c = start()
+	other := &apptest.Client{T: t, S: apptest.New_server(t), Cookies: c.Cookies}
+	apptest.Expect_body(t, other.Post("/login_totp", url.Values{"code": {codes[2]}}), "验证已过期，请重新登录")
+
+	// 删除账号时一并删除两步验证密钥，以同一用户名重新创建的账号不会沿用
+	root := apptest.Login(t, s, "root")
+	apptest.Expect_body(t, root.Get("/delete_admin?userID=collegeA"), "删除成功！")
+	if len(s.Query("SELECT * FROM user_totp WHERE userID='collegeA';")) != 0 {
+		t.Fatal("删除账号后仍保留两步验证密钥")
+	}
+	apptest.Expect_body(t, root.Post("/create_new_manager", url.Values{"name": {"collegeA"}, "type": {"3"}, "belonging_org": {"3"}}), "添加成功！")
+	apptest.Expect_body(t, apptest.Login(t, s, "collegeA").Get("/home.html"), "Welcome, collegeA")
+}
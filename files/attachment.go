@@ -0,0 +1,421 @@
+package files
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"Gin-ZJUST/server"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jmoiron/sqlx"
+)
+
+// 附件服务：上传的附件以内容的 SHA-256 摘要为键保存到附件存储（s.Storage）中，内容相同的附件只保存一份；
+// 每个附件有随机生成的ID，原文件名、类型、大小记录在 attachment 表中，摘要记录在 attachment_content 表中
+
+const Owner_appliance = "appliance" // 学生申请的证明材料
+const Owner_item = "item"           // 立项项目的策划材料
+
+type upload struct {
+	header *multipart.FileHeader
+	name   string
+	mime   string
+	hash   string // 内容的 SHA-256 摘要，即附件存储中的键
+	threat string // 病毒扫描发现的威胁，为空表示未发现
+}
+
+var Err_quarantined = &server.Error{Status: http.StatusForbidden, Code: "quarantined", Msg: "该附件未通过病毒扫描，已被隔离，不能下载"}
+var Err_scan_unavailable = &server.Error{Status: http.StatusServiceUnavailable, Code: "scan_unavailable", Msg: "附件安全扫描暂不可用，请稍后再试"}
+
+func Limit(s *server.Server) gin.HandlerFunc {
+	// 限制上传请求的大小，超出时解析表单失败，由 Save 返回错误
+	return func(c *gin.Context) {
+		c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, s.Config.Attachment.MaxTotal+1<<20)
+	}
+}
+
+func Clean_name(name string) string {
+	// 只保留文件名本身：去掉客户端路径、控制字符和首尾的点与空格，过长时截断
+	name = filepath.Base(strings.ReplaceAll(name, "\\", "/"))
+	name = strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) || r == '/' || r == '"' {
+			return -1
+		}
+		return r
+	}, name)
+	name = strings.Trim(name, ". ")
+	if runes := []rune(name); len(runes) > 100 {
+		ext := []rune(filepath.Ext(name))
+		if len(ext) > 10 {
+			ext = nil
+		}
+		name = string(runes[:100-len(ext)]) + string(ext)
+	}
+	if name == "" {
+		return "附件"
+	}
+	return name
+}
+
+func sniff(h *multipart.FileHeader) (string, error) {
+	// 根据文件开头的内容识别类型
+	f, err := h.Open()
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	buf := make([]byte, 512)
+	n, err := io.ReadFull(f, buf)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return "", err
+	}
+	media, _, _ := mime.ParseMediaType(http.DetectContentType(buf[:n]))
+	return media, nil
+}
+
+func allowed(s *server.Server, media string) bool {
+	for _, t := range s.Config.Attachment.Types {
+		if t == media {
+			return true
+		}
+	}
+	return false
+}
+
+func size_text(size int64) string {
+	// 按大小选择单位显示
+	switch {
+	case size < 1<<10:
+		return fmt.Sprintf("%dB", size)
+	case size < 1<<20:
+		return fmt.Sprintf("%.1fKB", float64(size)/(1<<10))
+	case size < 1<<30:
+		return fmt.Sprintf("%.1fMB", float64(size)/(1<<20))
+	}
+	return fmt.Sprintf("%.1fGB", float64(size)/(1<<30))
+}
+
+func Used(s *server.Server, owner_type string, ownerID int64) int64 {
+	// 申请或项目已上传附件的总大小
+	res := s.Query(fmt.Sprintf("SELECT COALESCE(SUM(size),0) AS total FROM attachment WHERE owner_type=%s AND ownerID=%d;", server.Join_strs([]string{owner_type}), ownerID))
+	if len(res) == 0 {
+		return 0
+	}
+	total, _ := res[0]["total"].(int64)
+	return total
+}
+
+func check(s *server.Server, c *gin.Context, owner_type string, ownerID int64) ([]upload, error) {
+	// 校验全部附件的大小和类型，任一附件不合要求时返回错误
+	form, err := c.MultipartForm()
+	var too_large *http.MaxBytesError
+	if errors.Is(err, http.ErrNotMultipart) {
+		return nil, nil
+	} else if errors.As(err, &too_large) {
+		return nil, &server.Error{Status: http.StatusRequestEntityTooLarge, Code: "too_large", Msg: "附件总大小超过 " + size_text(s.Config.Attachment.MaxTotal)}
+	} else if err != nil {
+		return nil, server.Err_bad_request
+	}
+	uploads := []upload{}
+	total := Used(s, owner_type, ownerID)
+	for _, headers := range form.File {
+		for _, h := range headers {
+			if h.Filename == "" && h.Size == 0 {
+				// 未选择文件的上传框
+				continue
+			}
+			name := Clean_name(h.Filename)
+			if h.Size > s.Config.Attachment.MaxFile {
+				return nil, &server.Error{Status: http.StatusRequestEntityTooLarge, Code: "too_large", Msg: fmt.Sprintf("附件「%s」超过 %s", name, size_text(s.Config.Attachment.MaxFile))}
+			}
+			total += h.Size
+			if total > s.Config.Attachment.MaxTotal {
+				return nil, &server.Error{Status: http.StatusRequestEntityTooLarge, Code: "too_large", Msg: "附件总大小超过 " + size_text(s.Config.Attachment.MaxTotal)}
+			}
+			media, err := sniff(h)
+			if err != nil {
+				return nil, server.Internal(err)
+			}
+			if !allowed(s, media) {
+				return nil, &server.Error{Status: http.StatusUnsupportedMediaType, Code: "unsupported_type", Msg: fmt.Sprintf("附件「%s」的类型（%s）不允许上传", name, media)}
+			}
+			uploads = append(uploads, upload{header: h, name: name, mime: media})
+		}
+	}
+	return uploads, nil
+}
+
+func key(a map[string]any) string {
+	// 附件在附件存储中的键：内容摘要；早期保存、没有摘要记录的附件为附件ID
+	if hash, ok := a["hash"].(string); ok {
+		return hash
+	}
+	return a["attachmentID"].(string)
+}
+
+var content_locks [64]sync.Mutex // 按内容分组的锁，使保存附件的「检查—保存—写入摘要记录」与删除的「检查引用—删除文件」互斥
+
+func content_lock(k string) *sync.Mutex {
+	h := fnv.New32a()
+	h.Write([]byte(k))
+	return &content_locks[h.Sum32()%uint32(len(content_locks))]
+}
+
+func stored(s *server.Server, hash string) bool {
+	return len(s.Query(fmt.Sprintf("SELECT attachmentID FROM attachment_content WHERE hash=%s LIMIT 1;", server.Join_strs([]string{hash})))) > 0
+}
+
+func store(s *server.Server, c *gin.Context, u upload) error {
+	// 已保存过相同内容时不再重复保存，需持有该内容的锁
+	if stored(s, u.hash) {
+		return nil
+	}
+	src, err := u.header.Open()
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	err = s.Storage.Put(c.Request.Context(), u.hash, src, u.header.Size, u.mime)
+	if errors.Is(err, os.ErrExist) {
+		// 之前保存失败遗留的文件，内容与摘要一致，可直接使用
+		return nil
+	}
+	return err
+}
+
+func save_one(s *server.Server, c *gin.Context, owner_type string, ownerID int64, attachmentID string, u upload) error {
+	// 保存附件内容并在同一事务中写入附件记录和摘要记录；写入完成前其他请求不会因内容未被引用而删除文件
+	lock := content_lock(u.hash)
+	lock.Lock()
+	defer lock.Unlock()
+	if err := store(s, c, u); err != nil {
+		return err
+	}
+	err := insert_attachment(s, c, owner_type, ownerID, attachmentID, u)
+	if err != nil {
+		delete_unused(s, c.Request.Context(), u.hash)
+	}
+	return err
+}
+
+func insert_attachment(s *server.Server, c *gin.Context, owner_type string, ownerID int64, attachmentID string, u upload) error {
+	tx, err := s.DB.Beginx()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if _, err = tx.Exec("INSERT INTO attachment VALUES(?,?,?,?,?,?,?,?);", attachmentID, owner_type, ownerID, u.name, u.mime, u.header.Size, c.GetString("userID"), time.Now().Unix()); err != nil {
+		return err
+	}
+	if _, err = tx.Exec("INSERT INTO attachment_content VALUES(?,?);", attachmentID, u.hash); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func delete_unused(s *server.Server, ctx context.Context, k string) {
+	// 没有附件再引用时删除附件存储中的文件，需持有该内容的锁
+	if stored(s, k) {
+		return
+	}
+	if err := s.Storage.Delete(ctx, k); err != nil {
+		s.Log.Error("删除附件失败", "key", k, "error", err)
+	}
+}
+
+func release(s *server.Server, ctx context.Context, k string) {
+	lock := content_lock(k)
+	lock.Lock()
+	defer lock.Unlock()
+	delete_unused(s, ctx, k)
+}
+
+func inspect(s *server.Server, c *gin.Context, u *upload) error {
+	// 计算内容摘要并扫描病毒；扫描器未读完的内容继续读入摘要
+	f, err := u.header.Open()
+	if err != nil {
+		return server.Internal(err)
+	}
+	defer f.Close()
+	h := sha256.New()
+	u.threat, err = s.Scanner.Scan(c.Request.Context(), io.TeeReader(f, h))
+	if err != nil {
+		s.Req_log(c).Error("附件扫描失败", "error", err)
+		return Err_scan_unavailable
+	}
+	if _, err = io.Copy(h, f); err != nil {
+		return server.Internal(err)
+	}
+	u.hash = hex.EncodeToString(h.Sum(nil))
+	return nil
+}
+
+func Save(s *server.Server, c *gin.Context, owner_type string, ownerID int64) ([]string, error) {
+	// 校验并保存请求中上传的全部附件，任一附件不合要求时不保存任何附件
+	// 未通过病毒扫描的附件仍然保存，但会被隔离，返回被隔离的附件名
+	uploads, err := check(s, c, owner_type, ownerID)
+	if err != nil {
+		return nil, err
+	}
+	for i := range uploads {
+		if err = inspect(s, c, &uploads[i]); err != nil {
+			return nil, err
+		}
+	}
+	if err = check_quota(s, owner_type, ownerID, uploads); err != nil {
+		return nil, err
+	}
+	saved := []string{}
+	quarantined := []string{}
+	for _, u := range uploads {
+		attachmentID := server.Produce_token()
+		err = save_one(s, c, owner_type, ownerID, attachmentID, u)
+		if err == nil {
+			saved = append(saved, attachmentID)
+			if u.threat != "" {
+				s.Req_log(c).Warn("附件未通过病毒扫描，已隔离", "attachmentID", attachmentID, "threat", u.threat)
+				_, err = s.DB.Exec("INSERT INTO quarantine VALUES(?,?,?);", attachmentID, u.threat, time.Now().Unix())
+				quarantined = append(quarantined, u.name)
+			}
+		}
+		if err != nil {
+			remove(s, saved)
+			return nil, server.Internal(err)
+		}
+		s.Metrics.Uploaded(owner_type, u.header.Size)
+	}
+	return quarantined, nil
+}
+
+func find(s *server.Server, c *gin.Context, attachmentID string) (map[string]any, error) {
+	// 查找当前用户可查看的附件；无权限时与附件不存在一样返回 Err_not_found，不泄露附件是否存在
+	a, err := s.Query_one(fmt.Sprintf("SELECT %s WHERE attachment.attachmentID=%s;", attachment_columns, server.Join_strs([]string{attachmentID})))
+	if err != nil {
+		return nil, err
+	}
+	if !Can_view(s, c, a["owner_type"].(string), a["ownerID"].(int64)) {
+		return nil, server.Err_not_found
+	}
+	if a["threat"] != nil {
+		return nil, Err_quarantined
+	}
+	return a, nil
+}
+
+func Quarantine_msg(names []string) string {
+	// 提示上传者哪些附件被隔离
+	if len(names) == 0 {
+		return ""
+	}
+	return "附件「" + strings.Join(names, "」「") + "」未通过病毒扫描，已被隔离。"
+}
+
+func Quarantined(s *server.Server, owner_type string, ownerIDs []int64) map[int64]int64 {
+	// 统计若干申请或项目中被隔离的附件数
+	res := map[int64]int64{}
+	sql := fmt.Sprintf("SELECT attachment.ownerID AS ownerID,COUNT(*) AS n FROM attachment,quarantine WHERE attachment.attachmentID=quarantine.attachmentID AND attachment.owner_type=%s AND attachment.ownerID IN (%s) GROUP BY attachment.ownerID;", server.Join_strs([]string{owner_type}), server.Join_ids(ownerIDs))
+	for _, row := range s.Query(sql) {
+		res[row["ownerID"].(int64)] = row["n"].(int64)
+	}
+	return res
+}
+
+// 附件记录及其内容摘要（hash）、隔离原因（threat），没有对应记录时为 nil
+const attachment_columns = "attachment.*,attachment_content.hash AS hash,quarantine.threat AS threat FROM attachment LEFT JOIN attachment_content ON attachment.attachmentID=attachment_content.attachmentID LEFT JOIN quarantine ON attachment.attachmentID=quarantine.attachmentID"
+
+func Of(s *server.Server, owner_type string, ownerIDs []int64) []map[string]any {
+	// 查询若干申请或项目的附件，被隔离的附件 threat 字段为威胁名称，否则为 nil
+	return s.Query(fmt.Sprintf("SELECT %s WHERE owner_type=%s AND ownerID IN (%s) ORDER BY attachment.time_unix;", attachment_columns, server.Join_strs([]string{owner_type}), server.Join_ids(ownerIDs)))
+}
+
+type Removed struct {
+	keys []string // 已删除附件的内容在附件存储中的键
+	ids  []string // 已删除的附件ID
+}
+
+func remove_with(s *server.Server, tx *sqlx.Tx, attachmentIDs []string) (Removed, error) {
+	// 在事务中删除附件记录，附件存储中的文件与缩略图在事务提交后由 Release 删除
+	r := Removed{ids: attachmentIDs}
+	if len(attachmentIDs) == 0 {
+		return r, nil
+	}
+	keys := map[string]bool{}
+	for _, a := range s.Query_with(tx, fmt.Sprintf("SELECT %s WHERE attachment.attachmentID IN (%s);", attachment_columns, server.Join_strs(attachmentIDs))) {
+		if !keys[key(a)] {
+			keys[key(a)] = true
+			r.keys = append(r.keys, key(a))
+		}
+	}
+	for _, table := range []string{"attachment", "attachment_content", "quarantine"} {
+		if _, err := tx.Exec(fmt.Sprintf("DELETE FROM %s WHERE attachmentID IN (%s);", table, server.Join_strs(attachmentIDs))); err != nil {
+			return Removed{}, err
+		}
+	}
+	return r, nil
+}
+
+func (r Removed) Release(s *server.Server) {
+	// 内容不再被其他附件引用时删除附件存储中的文件，并删除缩略图；记录已删除，失败时只记录日志
+	for _, k := range r.keys {
+		release(s, context.Background(), k)
+	}
+	for _, id := range r.ids {
+		if err := os.Remove(thumbnail_path(s, id)); err != nil && !os.IsNotExist(err) {
+			s.Log.Error("删除缩略图失败", "attachmentID", id, "error", err)
+		}
+	}
+}
+
+func Remove_with(s *server.Server, tx *sqlx.Tx, owner_type string, ownerIDs []int64) (Removed, error) {
+	// 在删除申请或项目的事务中一并删除其附件记录，提交后须调用 Release
+	ids := []string{}
+	for _, a := range s.Query_with(tx, fmt.Sprintf("SELECT attachmentID FROM attachment WHERE owner_type=%s AND ownerID IN (%s);", server.Join_strs([]string{owner_type}), server.Join_ids(ownerIDs))) {
+		ids = append(ids, a["attachmentID"].(string))
+	}
+	return remove_with(s, tx, ids)
+}
+
+func remove(s *server.Server, attachmentIDs []string) {
+	// 删除附件记录，内容不再被其他附件引用时一并删除附件存储中的文件
+	if len(attachmentIDs) == 0 {
+		return
+	}
+	tx, err := s.DB.Beginx()
+	if err != nil {
+		s.Log.Error("删除附件失败", "error", err)
+		return
+	}
+	defer tx.Rollback()
+	r, err := remove_with(s, tx, attachmentIDs)
+	if err == nil {
+		err = tx.Commit()
+	}
+	if err != nil {
+		s.Log.Error("删除附件失败", "error", err)
+		return
+	}
+	r.Release(s)
+}
+
+func Remove(s *server.Server, owner_type string, ownerIDs []int64) {
+	// 删除申请或项目时一并删除其附件
+	ids := []string{}
+	for _, a := range Of(s, owner_type, ownerIDs) {
+		ids = append(ids, a["attachmentID"].(string))
+	}
+	remove(s, ids)
+}
@@ -0,0 +1,241 @@
+package files_test
+
+import (
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+
+	"Gin-ZJUST/apptest"
+	"Gin-ZJUST/server"
+)
+
+func TestFileDownloadPermissions(t *testing.T) {
+	s := apptest.New_server(t)
+	id := apptest.Apply(t, s, apptest.Login(t, s, "stuA"), "学生附件")
+	basic := "/get_file?id=" + apptest.Attachment_of(s, "appliance", id)
+
+	w := apptest.Login(t, s, "collegeA").Upload("/add_activity_item", url.Values{"name": {"学院讲座"}, "type": {"2"}}, "策划案.txt", "学院附件")
+	apptest.Expect_body(t, w, "添加成功！")
+	itemID := s.Query("SELECT itemID FROM item WHERE name='学院讲座';")[0]["itemID"].(int64)
+	activity := "/get_file?id=" + apptest.Attachment_of(s, "item", itemID)
+
+	// 早期版本按 basic/学号/申请时间/ 存放的附件，权限同样由所属的申请决定
+	s.Exec(fmt.Sprintf("UPDATE appliance SET time_unix=1 WHERE applianceID=%d;", id))
+	if err := os.MkdirAll(s.Upload_root+"basic/stuA/1", os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	os.WriteFile(s.Upload_root+"basic/stuA/1/旧附件.txt", []byte("旧附件"), 0o644)
+	os.MkdirAll(s.Upload_root+"basic/stuA/2", os.ModePerm)
+	os.WriteFile(s.Upload_root+"basic/stuA/2/无主附件.txt", []byte("无主附件"), 0o644)
+	os.WriteFile(s.Upload_root+"data.db", []byte("数据库"), 0o644)
+	legacy := "/get_file?path=" + url.QueryEscape("upload/basic/stuA/1/旧附件.txt")
+
+	// 申请附件：本人及审核链上管辖该学生的团支部、学院、学校管理员和超级管理员可下载
+	// 立项附件：创建组织的管理员、学校管理员、超级管理员可下载
+	cases := []struct {
+		userID   string
+		path     string
+		content  string
+		download bool
+	}{
+		{"stuA", basic, "学生附件", true},
+		{"stuB", basic, "", false},
+		{"branchA", basic, "学生附件", true},
+		{"collegeA", basic, "学生附件", true},
+		{"branchB", basic, "", false},
+		{"collegeB", basic, "", false},
+		{"unit", basic, "", false},
+		{"school", basic, "学生附件", true},
+		{"root", basic, "学生附件", true},
+		{"collegeA", activity, "学院附件", true},
+		{"collegeB", activity, "", false},
+		{"stuA", activity, "", false},
+		{"branchA", activity, "", false},
+		{"unit", activity, "", false},
+		{"school", activity, "学院附件", true},
+		{"stuA", legacy, "旧附件", true},
+		{"stuB", legacy, "", false},
+		{"branchA", legacy, "旧附件", true},
+		{"branchB", legacy, "", false},
+		{"root", "/get_file?path=" + url.QueryEscape("upload/basic/stuA/2/无主附件.txt"), "", false},
+		{"stuA", "/get_file?path=" + url.QueryEscape("upload/basic/stuA/../../data.db"), "", false},
+		{"stuA", "/get_file?id=" + url.QueryEscape("' OR 1=1 --"), "", false},
+	}
+	for _, tc := range cases {
+		w := apptest.Login(t, s, tc.userID).Get(tc.path)
+		if tc.download && w.Body.String() != tc.content {
+			t.Errorf("%s 下载 %s 失败：%d %s", tc.userID, tc.path, w.Code, w.Body.String())
+		} else if !tc.download && w.Code != http.StatusNotFound {
+			t.Errorf("%s 不应能下载 %s：%d %s", tc.userID, tc.path, w.Code, w.Body.String())
+		}
+	}
+	if w := apptest.Login(t, s, "root").Get("/get_file?path=data.db"); w.Code != http.StatusNotFound {
+		t.Errorf("附件目录以外的路径应被拒绝：%d", w.Code)
+	}
+	// 审核页面列出证明材料；被收回审核权限的管理员不能再查看
+	w = apptest.Login(t, s, "branchA").Get(fmt.Sprintf("/audit_detail?applianceID=%d", id))
+	apptest.Expect_body(t, w, "证明.txt")
+	apptest.Expect_body(t, w, "旧附件.txt")
+	s.Exec(fmt.Sprintf("INSERT INTO admin_permission VALUES('branchA',%d);", server.Perm_check_branch_info))
+	if w := apptest.Login(t, s, "branchA").Get(basic); w.Code != http.StatusNotFound {
+		t.Errorf("无审核权限的管理员不应能下载：%d", w.Code)
+	}
+
+	w = apptest.Login(t, s, "stuA").Get(basic)
+	if w.Header().Get("Content-Type") != "text/plain" || w.Header().Get("X-Content-Type-Options") != "nosniff" || !strings.Contains(w.Header().Get("Content-Disposition"), "attachment") {
+		t.Errorf("下载附件的响应头有误：%v", w.Header())
+	}
+}
+
+func TestAttachmentUpload(t *testing.T) {
+	s := apptest.New_server(t)
+	s.Config.Attachment.MaxFile = 16
+	s.Config.Attachment.MaxTotal = 32
+	stu := apptest.Login(t, s, "stuA")
+	count := func() int {
+		return len(s.Query("SELECT * FROM appliance;"))
+	}
+
+	// 超过大小限制、类型不允许时不保存申请
+	w := stu.Upload("/apply_item?ID=1", url.Values{}, "大文件.txt", strings.Repeat("a", 17))
+	if w.Code != http.StatusOK || count() != 0 {
+		t.Fatalf("附件过大时不应保存申请：%d %d", w.Code, count())
+	}
+	apptest.Expect_body(t, w, "附件「大文件.txt」超过")
+	w = stu.Upload("/apply_item?ID=1", url.Values{}, "a.txt", strings.Repeat("a", 1<<20+64))
+	if w.Code != http.StatusOK || count() != 0 {
+		t.Fatalf("请求过大时不应保存申请：%d %d", w.Code, count())
+	}
+	apptest.Expect_body(t, w, "附件总大小超过")
+	w = stu.Upload("/apply_item?ID=1", url.Values{}, "a.txt", "\x7fELF\x02\x01\x01\x00")
+	if count() != 0 {
+		t.Fatal("类型不允许时不应保存申请")
+	}
+	apptest.Expect_body(t, w, "application/octet-stream")
+
+	// 文件名只保留最后一段，存放路径与文件名无关
+	w = stu.Upload("/apply_item?ID=1", url.Values{}, "../../x.txt", "证明")
+	apptest.Expect_body(t, w, "申请成功！")
+	res := s.Query("SELECT * FROM attachment WHERE name='x.txt';")
+	if len(res) != 1 || res[0]["mime"] != "text/plain" || res[0]["size"] != int64(len("证明")) {
+		t.Fatalf("附件记录有误：%v", res)
+	}
+	if _, err := os.Stat(s.Upload_root + "x.txt"); !os.IsNotExist(err) {
+		t.Fatal("附件不应按上传的文件名存放")
+	}
+}
+
+func new_fake_clamd(t *testing.T) (string, net.Listener) {
+	// 模拟 clamd 的 INSTREAM 命令，内容中含有 EICAR 时报告发现威胁
+	sock := t.TempDir() + "/clamd.sock"
+	l, err := net.Listen("unix", sock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				r := bufio.NewReader(conn)
+				if cmd, err := r.ReadString(0); err != nil || cmd != "zINSTREAM\x00" {
+					return
+				}
+				data := []byte{}
+				for {
+					size := make([]byte, 4)
+					if _, err := io.ReadFull(r, size); err != nil {
+						return
+					}
+					n := binary.BigEndian.Uint32(size)
+					if n == 0 {
+						break
+					}
+					chunk := make([]byte, n)
+					if _, err := io.ReadFull(r, chunk); err != nil {
+						return
+					}
+					data = append(data, chunk...)
+				}
+				if bytes.Contains(data, []byte("EICAR")) {
+					conn.Write([]byte("stream: Eicar-Test-Signature FOUND\x00"))
+				} else {
+					conn.Write([]byte("stream: OK\x00"))
+				}
+			}()
+		}
+	}()
+	return sock, l
+}
+
+func TestAttachmentScanning(t *testing.T) {
+	sock, l := new_fake_clamd(t)
+	s := apptest.New_server(t, func(c *server.Config) {
+		c.Scanner.Kind = "clamav"
+		c.Scanner.Network = "unix"
+		c.Scanner.Addr = sock
+	})
+
+	// 未通过扫描的附件仍随申请保存，但被隔离，上传者会收到提示
+	stu := apptest.Login(t, s, "stuA")
+	w := stu.Upload("/apply_item?ID=1", url.Values{}, "证明.txt", "EICAR-STANDARD-ANTIVIRUS-TEST-FILE")
+	apptest.Expect_body(t, w, "申请成功！附件「证明.txt」未通过病毒扫描，已被隔离。")
+	applianceID := s.Query("SELECT applianceID FROM appliance WHERE userID='stuA';")[0]["applianceID"].(int64)
+	attachmentID := apptest.Attachment_of(s, "appliance", applianceID)
+	if res := s.Query("SELECT threat FROM quarantine;"); len(res) != 1 || res[0]["threat"] != "Eicar-Test-Signature" {
+		t.Fatalf("隔离记录有误：%v", res)
+	}
+	clean := apptest.Apply(t, s, apptest.Login(t, s, "stuB"), "正常的证明材料")
+	if len(s.Query("SELECT * FROM quarantine;")) != 1 || apptest.Attachment_of(s, "appliance", clean) == "" {
+		t.Fatal("通过扫描的附件不应被隔离")
+	}
+
+	// 被隔离的附件不能下载、打包，审核人在待审核列表和审核页面看到警告
+	for _, userID := range []string{"stuA", "branchA", "root"} {
+		w := apptest.Login(t, s, userID).Get("/get_file?id=" + attachmentID)
+		if w.Code != http.StatusForbidden {
+			t.Fatalf("%s 不应能下载被隔离的附件：%d", userID, w.Code)
+		}
+		apptest.Expect_body(t, w, "已被隔离")
+	}
+	if w := apptest.Login(t, s, "stuB").Get("/get_file?id=" + attachmentID); w.Code != http.StatusNotFound {
+		t.Fatalf("无权查看的用户应返回 404：%d", w.Code)
+	}
+	branch := apptest.Login(t, s, "branchA")
+	apptest.Expect_body(t, branch.Get("/audit_basic.html"), "1 个附件已隔离")
+	w = branch.Get(fmt.Sprintf("/audit_detail?applianceID=%d", applianceID))
+	apptest.Expect_body(t, w, "警告：该申请有 1 个附件未通过病毒扫描")
+	apptest.Expect_body(t, w, "Eicar-Test-Signature")
+	body := branch.Get(fmt.Sprintf("/get_all_files?applianceID=%d", applianceID)).Body.Bytes()
+	if zr, err := zip.NewReader(bytes.NewReader(body), int64(len(body))); err != nil || len(zr.File) != 0 {
+		t.Fatal("打包下载时不应包含被隔离的附件")
+	}
+	apptest.Expect_body(t, branch.Get("/api/v1/audits/pending"), `"quarantined":1`)
+
+	// 撤回申请时一并删除隔离记录
+	stu = apptest.Login(t, s, "stuA")
+	apptest.Expect_body(t, stu.Get(fmt.Sprintf("/delete_appliance?applianceID=%d", applianceID)), "删除成功！")
+	if len(s.Query("SELECT * FROM quarantine;")) != 0 {
+		t.Fatal("撤回申请后应删除隔离记录")
+	}
+
+	// 扫描服务不可用时拒绝上传
+	l.Close()
+	w = apptest.Login(t, s, "collegeA").Upload("/add_activity_item", url.Values{"name": {"学院讲座"}, "type": {"2"}}, "策划案.txt", "策划案")
+	if w.Code != http.StatusServiceUnavailable || len(s.Query("SELECT * FROM item WHERE name='学院讲座';")) != 0 {
+		t.Fatalf("扫描服务不可用时应拒绝上传：%d %s", w.Code, w.Body.String())
+	}
+}
@@ -0,0 +1,199 @@
+package files
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"Gin-ZJUST/server"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 附件的列举、下载与预览。早期版本按 basic/学号/申请时间/、activity/组织ID/立项时间/ 存放的附件仍可列举和下载，新上传的附件由附件服务保存
+
+func legacy_dir(s *server.Server, owner_type string, ownerID int64) string {
+	// 早期版本存放附件的目录（upload/...），申请或项目不存在时返回空字符串
+	if owner_type == Owner_appliance {
+		ap := s.Query(fmt.Sprintf("SELECT userID,time_unix FROM appliance WHERE applianceID=%d;", ownerID))
+		if len(ap) > 0 {
+			return fmt.Sprintf("upload/basic/%s/%d/", ap[0]["userID"], ap[0]["time_unix"])
+		}
+	} else {
+		item := s.Query(fmt.Sprintf("SELECT create_org,time_unix FROM item WHERE itemID=%d;", ownerID))
+		if len(item) > 0 {
+			return fmt.Sprintf("upload/activity/%d/%d/", item[0]["create_org"], item[0]["time_unix"])
+		}
+	}
+	return ""
+}
+
+func legacy_files(s *server.Server, owner_type string, ownerID int64) []string {
+	// 早期版本存放的附件，返回 upload/... 形式的路径
+	dir := legacy_dir(s, owner_type, ownerID)
+	if dir == "" {
+		return nil
+	}
+	res := []string{}
+	entries, _ := os.ReadDir(s.Upload_file(dir))
+	for _, file := range entries {
+		if !file.IsDir() {
+			res = append(res, dir+file.Name())
+		}
+	}
+	return res
+}
+
+func List(s *server.Server, owner_type string, ownerID int64) []gin.H {
+	// 列出申请或项目的附件，返回文件名、下载链接，以及图片、PDF的预览方式（preview）；被隔离的附件返回威胁名称（threat），没有下载链接
+	res := []gin.H{}
+	for _, a := range Of(s, owner_type, []int64{ownerID}) {
+		id := a["attachmentID"].(string)
+		if a["threat"] != nil {
+			// 被隔离的附件只显示名称和警告
+			res = append(res, gin.H{"name": a["name"], "threat": a["threat"], "preview": ""})
+			continue
+		}
+		file := gin.H{
+			"name":    a["name"],
+			"link":    "/get_file?id=" + id,
+			"preview": preview_kind(a["mime"].(string)),
+		}
+		if file["preview"] != "" {
+			file["inline"] = "/get_file?inline=1&id=" + id
+		}
+		if a["mime"] == "image/webp" {
+			// 无法解码 WebP，浏览器直接显示原图
+			file["thumbnail"] = file["inline"]
+		} else if file["preview"] == "image" {
+			file["thumbnail"] = "/get_thumbnail?id=" + id
+		}
+		res = append(res, file)
+	}
+	for _, file := range legacy_files(s, owner_type, ownerID) {
+		res = append(res, gin.H{
+			"name":    path.Base(file),
+			"link":    "/get_file?path=" + url.QueryEscape(file),
+			"preview": "",
+		})
+	}
+	return res
+}
+
+func Can_view(s *server.Server, c *gin.Context, owner_type string, ownerID int64) bool {
+	// 附件的查看权限由所属的申请或项目决定：
+	// 申请附件：申请人本人，以及审核链上管辖该学生、具有基础项目审核权限的团支部、学院、学校管理员和超级管理员
+	// 立项附件：创建组织的管理员，以及具有立项审核权限的学校管理员和超级管理员
+	userID := c.GetString("userID")
+	account_type := c.GetInt64("account_type")
+	auth := s.User_authorities(userID, account_type)
+	if owner_type == Owner_appliance {
+		ap := s.Query(fmt.Sprintf("SELECT userID FROM appliance WHERE applianceID=%d;", ownerID))
+		if len(ap) == 0 {
+			return false
+		}
+		owner := ap[0]["userID"].(string)
+		return owner == userID || auth&server.Perm_audit_basic != 0 && s.Student_in_scope(account_type, c.GetInt64("belonging_org"), owner)
+	}
+	item := s.Query(fmt.Sprintf("SELECT create_org FROM item WHERE itemID=%d;", ownerID))
+	if len(item) == 0 {
+		return false
+	}
+	return account_type != 5 && item[0]["create_org"] == c.GetInt64("belonging_org") || auth&server.Perm_audit_added != 0
+}
+
+func legacy_owner(s *server.Server, file string) (string, int64, bool) {
+	// 早期版本的附件路径为 upload/basic/学号/申请时间/文件名 或 upload/activity/组织ID/立项时间/文件名，据此查找所属的申请或项目
+	fields := strings.Split(file, "/")
+	if len(fields) != 5 || fields[0] != "upload" || path.Clean(file) != file {
+		// 拒绝 .. 等可能跳出所属目录的路径
+		return "", 0, false
+	}
+	time_unix, err := strconv.ParseInt(fields[3], 10, 64)
+	if err != nil {
+		return "", 0, false
+	}
+	if fields[1] == "basic" {
+		ap := s.Query(fmt.Sprintf("SELECT applianceID FROM appliance WHERE userID=%s AND time_unix=%d;", server.Join_strs([]string{fields[2]}), time_unix))
+		if len(ap) > 0 {
+			return Owner_appliance, ap[0]["applianceID"].(int64), true
+		}
+	} else if fields[1] == "activity" {
+		orgID, err := strconv.ParseInt(fields[2], 10, 64)
+		if err != nil {
+			return "", 0, false
+		}
+		item := s.Query(fmt.Sprintf("SELECT itemID FROM item WHERE create_org=%d AND time_unix=%d;", orgID, time_unix))
+		if len(item) > 0 {
+			return Owner_item, item[0]["itemID"].(int64), true
+		}
+	}
+	return "", 0, false
+}
+
+func Register(s *server.Server) {
+	r := s.Router
+
+	r.GET("/get_file", s.Midware_Auth, s.Authorities(0b111111), s.Handle(func(c *gin.Context) error {
+		// 无权限与附件不存在一律返回 Err_not_found，不泄露附件是否存在
+		if id := c.Query("id"); id != "" {
+			a, err := find(s, c, id)
+			if err != nil {
+				return err
+			}
+			// 按记录的类型返回，并禁止浏览器自行猜测类型
+			media := a["mime"].(string)
+			disposition := "attachment"
+			if c.Query("inline") == "1" && preview_kind(media) != "" {
+				// 审核页面内嵌预览图片、PDF
+				disposition = "inline"
+			}
+			disposition = mime.FormatMediaType(disposition, map[string]string{"filename": a["name"].(string)})
+			link, err := s.Storage.Presign(key(a), disposition, media)
+			if err != nil {
+				return server.Internal(err)
+			} else if link != "" {
+				// 对象存储的临时链接，由浏览器直接下载
+				c.Redirect(http.StatusFound, link)
+				return nil
+			}
+			f, err := s.Storage.Get(c.Request.Context(), key(a))
+			if errors.Is(err, os.ErrNotExist) {
+				return server.Err_not_found
+			} else if err != nil {
+				return server.Internal(err)
+			}
+			defer f.Close()
+			c.Header("Content-Type", media)
+			c.Header("Content-Disposition", disposition)
+			c.Header("X-Content-Type-Options", "nosniff")
+			if seeker, ok := f.(io.ReadSeeker); ok {
+				// 本地存储的附件支持 Range 请求
+				http.ServeContent(c.Writer, c.Request, "", time.Unix(a["time_unix"].(int64), 0), seeker)
+			} else {
+				c.DataFromReader(http.StatusOK, a["size"].(int64), media, f, nil)
+			}
+			return nil
+		}
+
+		file := c.Query("path")
+		owner_type, ownerID, ok := legacy_owner(s, file)
+		if !ok || !Can_view(s, c, owner_type, ownerID) {
+			return server.Err_not_found
+		}
+		c.Header("X-Content-Type-Options", "nosniff")
+		c.File(s.Upload_file(file))
+		return nil
+	}))
+
+	register_preview(s)
+	register_quota(s)
+}
@@ -0,0 +1,222 @@
+package files
+
+import (
+	"archive/zip"
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	_ "image/gif"
+	"image/jpeg"
+	_ "image/png"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"Gin-ZJUST/server"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 审核页面的附件预览：图片显示缩略图，PDF 内嵌显示；以及将申请或项目的全部附件打包下载
+
+const thumbnail_size = 240          // 缩略图的最大宽高（像素）
+const thumbnail_pixels = 40_000_000 // 超过该像素数的图片不生成缩略图，避免解码时占用过多内存
+
+func preview_kind(media string) string {
+	// 可在浏览器中直接显示的附件类型
+	switch media {
+	case "image/jpeg", "image/png", "image/gif", "image/webp":
+		return "image"
+	case "application/pdf":
+		return "pdf"
+	}
+	return ""
+}
+
+func thumbnail_path(s *server.Server, attachmentID string) string {
+	// 缩略图缓存在附件目录的 thumbnails/ 下，使用对象存储时同样缓存在本地
+	return s.Upload_root + "thumbnails/" + attachmentID[:2] + "/" + attachmentID + ".jpg"
+}
+
+func shrink(src image.Image) image.Image {
+	// 按比例缩小到 thumbnail_size 以内，每个像素取源图中对应区域的平均颜色，透明部分以白色填充
+	b := src.Bounds()
+	w, h := b.Dx(), b.Dy()
+	tw, th := w, h
+	if w > thumbnail_size || h > thumbnail_size {
+		if w >= h {
+			tw, th = thumbnail_size, max(1, h*thumbnail_size/w)
+		} else {
+			tw, th = max(1, w*thumbnail_size/h), thumbnail_size
+		}
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, tw, th))
+	for y := 0; y < th; y++ {
+		y0, y1 := b.Min.Y+y*h/th, b.Min.Y+max((y+1)*h/th, y*h/th+1)
+		for x := 0; x < tw; x++ {
+			x0, x1 := b.Min.X+x*w/tw, b.Min.X+max((x+1)*w/tw, x*w/tw+1)
+			var r, g, bl, n uint64
+			for sy := y0; sy < y1; sy++ {
+				for sx := x0; sx < x1; sx++ {
+					cr, cg, cb, ca := src.At(sx, sy).RGBA()
+					r += uint64(cr + 0xffff - ca)
+					g += uint64(cg + 0xffff - ca)
+					bl += uint64(cb + 0xffff - ca)
+					n++
+				}
+			}
+			dst.Set(x, y, color.RGBA64{uint16(r / n), uint16(g / n), uint16(bl / n), 0xffff})
+		}
+	}
+	return dst
+}
+
+func make_thumbnail(s *server.Server, c *gin.Context, a map[string]any, file string) error {
+	// 读取附件生成 JPEG 缩略图，先写入临时文件再改名，避免并发请求读到不完整的缩略图
+	f, err := s.Storage.Get(c.Request.Context(), key(a))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	data, err := io.ReadAll(io.LimitReader(f, s.Config.Attachment.MaxFile+1))
+	if err != nil {
+		return err
+	}
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	if config.Width*config.Height > thumbnail_pixels {
+		return fmt.Errorf("图片过大：%dx%d", config.Width, config.Height)
+	}
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	if err = os.MkdirAll(filepath.Dir(file), os.ModePerm); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(file), ".thumbnail-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if err = jpeg.Encode(tmp, shrink(img), &jpeg.Options{Quality: 80}); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err = tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), file)
+}
+
+func zip_name(used map[string]int, name string) string {
+	// 压缩包中的同名文件依次改为 name (2).ext、name (3).ext
+	used[name]++
+	if used[name] == 1 {
+		return name
+	}
+	ext := path.Ext(name)
+	return zip_name(used, fmt.Sprintf("%s (%d)%s", strings.TrimSuffix(name, ext), used[name], ext))
+}
+
+func write_zip(s *server.Server, c *gin.Context, owner_type string, ownerID int64, name string) {
+	// 边读取边写入压缩包；响应开始后出错无法再返回错误页，只记录日志
+	c.Header("Content-Type", "application/zip")
+	c.Header("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": name}))
+	c.Header("X-Content-Type-Options", "nosniff")
+	c.Status(http.StatusOK)
+	zw := zip.NewWriter(c.Writer)
+	used := map[string]int{}
+	add := func(name string, open func() (io.ReadCloser, error)) error {
+		f, err := open()
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		w, err := zw.Create(zip_name(used, name))
+		if err != nil {
+			return err
+		}
+		_, err = io.Copy(w, f)
+		return err
+	}
+	for _, a := range Of(s, owner_type, []int64{ownerID}) {
+		if a["threat"] != nil {
+			// 不打包被隔离的附件
+			continue
+		}
+		id, k := a["attachmentID"].(string), key(a)
+		err := add(a["name"].(string), func() (io.ReadCloser, error) {
+			return s.Storage.Get(c.Request.Context(), k)
+		})
+		if err != nil {
+			s.Req_log(c).Error("打包附件失败", "attachmentID", id, "error", err)
+			return
+		}
+	}
+	for _, file := range legacy_files(s, owner_type, ownerID) {
+		err := add(path.Base(file), func() (io.ReadCloser, error) {
+			return os.Open(s.Upload_file(file))
+		})
+		if err != nil {
+			s.Req_log(c).Error("打包附件失败", "error", err)
+			return
+		}
+	}
+	if err := zw.Close(); err != nil {
+		s.Req_log(c).Error("打包附件失败", "error", err)
+	}
+}
+
+func register_preview(s *server.Server) {
+	r := s.Router
+
+	r.GET("/get_thumbnail", s.Midware_Auth, s.Authorities(0b111111), s.Handle(func(c *gin.Context) error {
+		// 图片附件的缩略图，首次请求时生成并缓存
+		id := c.Query("id")
+		a, err := find(s, c, id)
+		if err != nil {
+			return err
+		}
+		if preview_kind(a["mime"].(string)) != "image" || a["mime"] == "image/webp" {
+			return server.Err_not_found
+		}
+		file := thumbnail_path(s, id)
+		if _, err = os.Stat(file); os.IsNotExist(err) {
+			if err = make_thumbnail(s, c, a, file); err != nil {
+				// 图片损坏或过大时不显示缩略图
+				s.Req_log(c).Warn("生成缩略图失败", "attachmentID", id, "error", err)
+				return server.Err_not_found
+			}
+		}
+		c.Header("X-Content-Type-Options", "nosniff")
+		c.Header("Cache-Control", "private, max-age=86400")
+		c.File(file)
+		return nil
+	}))
+
+	r.GET("/get_all_files", s.Midware_Auth, s.Authorities(0b111111), s.Handle(func(c *gin.Context) error {
+		// 将申请（applianceID）或项目（itemID）的全部附件打包为 zip 下载
+		owner_type, param, name := Owner_appliance, "applianceID", "申请%d的附件.zip"
+		if c.Query("itemID") != "" {
+			owner_type, param, name = Owner_item, "itemID", "项目%d的附件.zip"
+		}
+		ownerID, err := strconv.ParseInt(c.Query(param), 10, 64)
+		if err != nil {
+			return server.Err_bad_request
+		}
+		if !Can_view(s, c, owner_type, ownerID) {
+			return server.Err_not_found
+		}
+		write_zip(s, c, owner_type, ownerID, fmt.Sprintf(name, ownerID))
+		return nil
+	}))
+}
@@ -0,0 +1,94 @@
+package files_test
+
+import (
+	"archive/zip"
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+
+	"Gin-ZJUST/apptest"
+)
+
+func TestAttachmentPreview(t *testing.T) {
+	s := apptest.New_server(t)
+	img := image.NewRGBA(image.Rect(0, 0, 500, 300))
+	draw.Draw(img, img.Bounds(), image.NewUniform(color.RGBA{255, 0, 0, 255}), image.Point{}, draw.Src)
+	png_data := &bytes.Buffer{}
+	png.Encode(png_data, img)
+	stu := apptest.Login(t, s, "stuA")
+	apptest.Expect_body(t, stu.Upload("/apply_item?ID=1", url.Values{}, "照片.png", png_data.String()), "申请成功！")
+	ap := s.Query("SELECT applianceID,time_unix FROM appliance;")[0]
+	applianceID := ap["applianceID"].(int64)
+	attachmentID := apptest.Attachment_of(s, "appliance", applianceID)
+
+	// 审核页面显示缩略图和下载全部附件的链接
+	branch := apptest.Login(t, s, "branchA")
+	w := branch.Get(fmt.Sprintf("/audit_detail?applianceID=%d", applianceID))
+	for _, want := range []string{"/get_thumbnail?id&#61;" + attachmentID, "inline&#61;1", "/get_all_files?applianceID&#61;"} {
+		apptest.Expect_body(t, w, want)
+	}
+
+	// 缩略图按比例缩小为 JPEG 并缓存
+	w = branch.Get("/get_thumbnail?id=" + attachmentID)
+	if w.Code != http.StatusOK || w.Header().Get("Content-Type") != "image/jpeg" {
+		t.Fatalf("缩略图有误：%d %v", w.Code, w.Header())
+	}
+	thumb, err := jpeg.Decode(w.Body)
+	if err != nil || thumb.Bounds().Dx() != 240 || thumb.Bounds().Dy() != 144 {
+		t.Fatalf("缩略图尺寸有误：%v %v", err, thumb)
+	}
+	if r, g, b, _ := thumb.At(120, 72).RGBA(); r>>8 < 240 || g>>8 > 15 || b>>8 > 15 {
+		t.Fatalf("缩略图颜色有误：%d %d %d", r>>8, g>>8, b>>8)
+	}
+	cache := s.Upload_root + "thumbnails/" + attachmentID[:2] + "/" + attachmentID + ".jpg"
+	if _, err := os.Stat(cache); err != nil {
+		t.Fatalf("缩略图未缓存：%v", err)
+	}
+	if w := apptest.Login(t, s, "stuB").Get("/get_thumbnail?id=" + attachmentID); w.Code != http.StatusNotFound {
+		t.Fatalf("其他学生不应能查看缩略图：%d", w.Code)
+	}
+
+	// 图片、PDF 可内嵌显示，其他类型仍作为附件下载
+	w = branch.Get("/get_file?inline=1&id=" + attachmentID)
+	if !strings.HasPrefix(w.Header().Get("Content-Disposition"), "inline") || w.Header().Get("Content-Type") != "image/png" {
+		t.Fatalf("内嵌显示的响应头有误：%v", w.Header())
+	}
+
+	// 打包下载全部附件，包括早期版本存放的附件，同名文件自动改名
+	dir := fmt.Sprintf("%sbasic/stuA/%d/", s.Upload_root, ap["time_unix"].(int64))
+	os.MkdirAll(dir, os.ModePerm)
+	os.WriteFile(dir+"照片.png", []byte("旧附件"), 0o644)
+	w = branch.Get(fmt.Sprintf("/get_all_files?applianceID=%d", applianceID))
+	if w.Code != http.StatusOK || w.Header().Get("Content-Type") != "application/zip" {
+		t.Fatalf("打包下载有误：%d %v", w.Code, w.Header())
+	}
+	zr, err := zip.NewReader(bytes.NewReader(w.Body.Bytes()), int64(w.Body.Len()))
+	if err != nil || len(zr.File) != 2 || zr.File[0].Name != "照片.png" || zr.File[1].Name != "照片 (2).png" {
+		t.Fatalf("压缩包内容有误：%v", err)
+	}
+	f, _ := zr.File[1].Open()
+	if content, _ := io.ReadAll(f); string(content) != "旧附件" {
+		t.Fatalf("压缩包中的文件内容有误：%s", content)
+	}
+	for _, path := range []string{fmt.Sprintf("/get_all_files?applianceID=%d", applianceID), "/get_all_files?itemID=1"} {
+		if w := apptest.Login(t, s, "stuB").Get(path); w.Code != http.StatusNotFound {
+			t.Fatalf("%s 返回 %d", path, w.Code)
+		}
+	}
+
+	// 撤回申请时一并删除缩略图
+	apptest.Expect_body(t, stu.Get(fmt.Sprintf("/delete_appliance?applianceID=%d", applianceID)), "删除成功！")
+	if _, err := os.Stat(cache); !os.IsNotExist(err) {
+		t.Fatal("撤回申请后应删除缩略图")
+	}
+}
@@ -0,0 +1,186 @@
+package files
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+
+	"Gin-ZJUST/server"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 附件配额：每个学生的申请附件、每个组织的立项附件分别计算已用空间，内容相同的附件只计一次；以及学校管理员查看的附件存储用量报表
+
+const appliance_join = "JOIN appliance ON attachment.owner_type='appliance' AND attachment.ownerID=appliance.applianceID" // 申请附件，按 appliance.userID 计入学生
+const item_join = "JOIN item ON attachment.owner_type='item' AND attachment.ownerID=item.itemID"                          // 立项附件，按 item.create_org 计入组织
+
+const top_students = 20 // 报表中列出用量最多的学生数
+
+type quota struct {
+	name  string // 配额所属的学生或组织，用于提示
+	join  string // 筛选计入配额的附件
+	limit int64  // 0 表示不限
+	used  int64
+}
+
+func usage(s *server.Server, join string, group string) map[any]int64 {
+	// 按 group 分组统计附件用量：同组内内容相同的附件只计一次，早期没有摘要记录的附件各计一次
+	sql := fmt.Sprintf("SELECT g,SUM(size) AS total FROM (SELECT %s AS g,MAX(attachment.size) AS size FROM attachment LEFT JOIN attachment_content ON attachment.attachmentID=attachment_content.attachmentID %s GROUP BY g,COALESCE(attachment_content.hash,attachment.attachmentID)) GROUP BY g;", group, join)
+	res := map[any]int64{}
+	for _, row := range s.Query(sql) {
+		res[row["g"]] = row["total"].(int64)
+	}
+	return res
+}
+
+func user_quota(s *server.Server, userID string) quota {
+	join := fmt.Sprintf("%s AND appliance.userID=%s", appliance_join, server.Join_strs([]string{userID}))
+	return quota{
+		name:  "学生" + userID,
+		join:  join,
+		limit: s.Config.Attachment.QuotaUser,
+		used:  usage(s, join, "appliance.userID")[userID],
+	}
+}
+
+func org_quota(s *server.Server, orgID int64) quota {
+	join := fmt.Sprintf("%s AND item.create_org=%d", item_join, orgID)
+	return quota{
+		name:  "组织「" + s.Org_name(orgID) + "」",
+		join:  join,
+		limit: s.Config.Attachment.QuotaOrg,
+		used:  usage(s, join, "item.create_org")[orgID],
+	}
+}
+
+func quota_of(s *server.Server, owner_type string, ownerID int64) (quota, bool) {
+	// 申请附件计入申请人的配额，立项附件计入创建组织的配额
+	if owner_type == Owner_appliance {
+		ap := s.Query(fmt.Sprintf("SELECT userID FROM appliance WHERE applianceID=%d;", ownerID))
+		if len(ap) == 0 {
+			return quota{}, false
+		}
+		return user_quota(s, ap[0]["userID"].(string)), true
+	}
+	item := s.Query(fmt.Sprintf("SELECT create_org FROM item WHERE itemID=%d;", ownerID))
+	if len(item) == 0 {
+		return quota{}, false
+	}
+	return org_quota(s, item[0]["create_org"].(int64)), true
+}
+
+func check_quota(s *server.Server, owner_type string, ownerID int64, uploads []upload) error {
+	// 上传后超出配额时拒绝本次上传；与已有附件内容相同的附件不占用新的空间
+	q, ok := quota_of(s, owner_type, ownerID)
+	if !ok || q.limit == 0 {
+		return nil
+	}
+	seen := map[string]bool{}
+	for _, row := range s.Query(fmt.Sprintf("SELECT attachment_content.hash AS hash FROM attachment JOIN attachment_content ON attachment.attachmentID=attachment_content.attachmentID %s;", q.join)) {
+		seen[row["hash"].(string)] = true
+	}
+	used := q.used
+	for _, u := range uploads {
+		if !seen[u.hash] {
+			seen[u.hash] = true
+			used += u.header.Size
+		}
+	}
+	if used > q.limit {
+		return &server.Error{Status: http.StatusRequestEntityTooLarge, Code: "quota_exceeded", Msg: fmt.Sprintf("%s的附件空间不足：上传后共 %s，配额为 %s", q.name, size_text(used), size_text(q.limit))}
+	}
+	return nil
+}
+
+func (q quota) info() gin.H {
+	res := gin.H{"used": size_text(q.used), "limit": "不限", "percent": 0, "full": false}
+	if q.limit > 0 {
+		res["limit"] = size_text(q.limit)
+		res["percent"] = q.used * 100 / q.limit
+		res["full"] = q.used >= q.limit
+	}
+	return res
+}
+
+func Quota(s *server.Server, c *gin.Context) gin.H {
+	// 个人信息页显示的附件空间：学生为本人的申请附件，单位、学院、团支部管理员为本组织的立项附件，其他账号返回 nil
+	var q quota
+	switch c.GetInt64("account_type") {
+	case 5:
+		q = user_quota(s, c.GetString("userID"))
+	case 2, 3, 4:
+		q = org_quota(s, c.GetInt64("belonging_org"))
+	default:
+		return nil
+	}
+	res := q.info()
+	res["name"] = q.name
+	return res
+}
+
+func register_quota(s *server.Server) {
+	r := s.Router
+
+	r.GET("/storage_usage.html", s.Midware_Auth, s.Authorities(0b000011), s.Handle(func(c *gin.Context) error {
+		// 附件存储用量报表：总量与去重节省的空间、各组织的立项附件和学生附件用量、用量最多的学生
+		total, err := s.Query_one("SELECT COUNT(*) AS n,COALESCE(SUM(size),0) AS total FROM attachment;")
+		if err != nil {
+			return err
+		}
+		stored, err := s.Query_one("SELECT COUNT(*) AS n,COALESCE(SUM(size),0) AS total FROM (SELECT MAX(attachment.size) AS size FROM attachment LEFT JOIN attachment_content ON attachment.attachmentID=attachment_content.attachmentID GROUP BY COALESCE(attachment_content.hash,attachment.attachmentID));")
+		if err != nil {
+			return err
+		}
+		total_size, ok := total["total"].(int64)
+		stored_size, ok2 := stored["total"].(int64)
+		if !ok || !ok2 {
+			return server.Internal(fmt.Errorf("附件用量类型有误：%T %T", total["total"], stored["total"]))
+		}
+
+		students := usage(s, appliance_join, "appliance.userID")
+		branch_used := map[int64]int64{}
+		belonging := map[string]int64{}
+		for _, u := range s.Query("SELECT userID,belonging_org FROM user WHERE account_type=5;") {
+			userID, orgID := u["userID"].(string), u["belonging_org"].(int64)
+			belonging[userID] = orgID
+			branch_used[orgID] += students[userID]
+		}
+		items := usage(s, item_join, "item.create_org")
+		orgs := s.Query("SELECT orgID,name,type FROM organization ORDER BY orgID;")
+		for _, org := range orgs {
+			orgID := org["orgID"].(int64)
+			q := quota{limit: s.Config.Attachment.QuotaOrg, used: items[orgID]}
+			org["type"] = server.Org_type[org["type"].(int64)]
+			org["items"] = q.info()
+			org["students"] = size_text(branch_used[orgID])
+		}
+
+		top := []gin.H{}
+		for userID, used := range students {
+			userID := userID.(string)
+			q := quota{limit: s.Config.Attachment.QuotaUser, used: used}
+			top = append(top, gin.H{"userID": userID, "org": s.Org_name(belonging[userID]), "usage": q.info(), "bytes": used})
+		}
+		sort.Slice(top, func(i, j int) bool {
+			if top[i]["bytes"] != top[j]["bytes"] {
+				return top[i]["bytes"].(int64) > top[j]["bytes"].(int64)
+			}
+			return top[i]["userID"].(string) < top[j]["userID"].(string)
+		})
+		if len(top) > top_students {
+			top = top[:top_students]
+		}
+
+		c.HTML(http.StatusOK, "storage_usage.html", gin.H{
+			"count":    total["n"],
+			"total":    size_text(total_size),
+			"contents": stored["n"],
+			"stored":   size_text(stored_size),
+			"saved":    size_text(total_size - stored_size),
+			"orgs":     orgs,
+			"students": top,
+		})
+		return nil
+	}))
+}
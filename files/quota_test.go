@@ -0,0 +1,73 @@
+package files_test
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+
+	"Gin-ZJUST/apptest"
+	"Gin-ZJUST/server"
+)
+
+func TestAttachmentDedupAndQuota(t *testing.T) {
+	s := apptest.New_server(t, func(c *server.Config) {
+		c.Attachment.QuotaUser = 20
+		c.Attachment.QuotaOrg = 10
+	})
+	blob := s.Upload_root + "files/" + apptest.Content_key("0123456789")[:2] + "/" + apptest.Content_key("0123456789")
+
+	// 重复上传相同的证明材料只保存一份，配额也只计一次
+	stu := apptest.Login(t, s, "stuA")
+	first := apptest.Apply(t, s, stu, "0123456789")
+	s.Exec(fmt.Sprintf("UPDATE appliance SET time_unix=1 WHERE applianceID=%d;", first))
+	second := apptest.Apply(t, s, stu, "0123456789")
+	if len(s.Query("SELECT * FROM attachment;")) != 2 || len(s.Query(fmt.Sprintf("SELECT * FROM attachment_content WHERE hash='%s';", apptest.Content_key("0123456789")))) != 2 {
+		t.Fatal("两次申请应各有一条附件记录，指向同一份内容")
+	}
+	if entries, _ := os.ReadDir(s.Upload_root + "files/" + apptest.Content_key("0123456789")[:2]); len(entries) != 1 {
+		t.Fatalf("相同内容应只保存一份：%v", entries)
+	}
+	apptest.Expect_body(t, stu.Get("/manage_self_info.html"), "学生stuA已使用 10B，配额 20B")
+	w := stu.Get("/get_file?id=" + apptest.Attachment_of(s, "appliance", second))
+	if w.Code != http.StatusOK || w.Body.String() != "0123456789" {
+		t.Fatalf("下载去重后的附件有误：%d %s", w.Code, w.Body.String())
+	}
+
+	// 超出配额时不保存申请
+	s.Exec(fmt.Sprintf("UPDATE appliance SET time_unix=2 WHERE applianceID=%d;", second))
+	w = stu.Upload("/apply_item?ID=1", url.Values{}, "证明.txt", "abcdefghijk")
+	apptest.Expect_body(t, w, "申请失败：学生stuA的附件空间不足：上传后共 21B，配额为 20B")
+	if len(s.Query("SELECT * FROM appliance WHERE userID='stuA';")) != 2 {
+		t.Fatal("超出配额时不应保存申请")
+	}
+	college := apptest.Login(t, s, "collegeA")
+	apptest.Expect_body(t, college.Get("/manage_self_info.html"), "组织「学院A」已使用 0B，配额 10B")
+	w = college.Upload("/add_activity_item", url.Values{"name": {"学院讲座"}, "type": {"2"}}, "策划案.txt", "abcdefghijk")
+	apptest.Expect_body(t, w, "添加失败：组织「学院A」的附件空间不足：上传后共 11B，配额为 10B")
+
+	// 学校管理员查看用量报表
+	school := apptest.Login(t, s, "school")
+	apptest.Expect_body(t, school.Get("/home.html"), "storage_usage.html")
+	w = school.Get("/storage_usage.html")
+	apptest.Expect_body(t, w, "附件 2 个，共 20B；去重后实际保存 1 份，占用 10B，节省 10B")
+	apptest.Expect_body(t, w, "<td>stuA</td>\n<td>团支部A</td>\n<td>10B</td>\n<td>20B</td>\n<td>50%")
+	if w := apptest.Login(t, s, "collegeA").Get("/storage_usage.html"); strings.Contains(w.Body.String(), "去重后实际保存") {
+		t.Fatal("学院管理员不应能查看用量报表")
+	}
+
+	// 最后一个引用该内容的附件删除后才删除文件
+	apptest.Expect_body(t, stu.Get(fmt.Sprintf("/delete_appliance?applianceID=%d", first)), "删除成功！")
+	if _, err := os.Stat(blob); err != nil {
+		t.Fatal("仍被引用的内容不应删除")
+	}
+	apptest.Expect_body(t, stu.Get(fmt.Sprintf("/delete_appliance?applianceID=%d", second)), "删除成功！")
+	if _, err := os.Stat(blob); !os.IsNotExist(err) {
+		t.Fatal("不再被引用的内容应删除")
+	}
+	if len(s.Query("SELECT * FROM attachment_content;")) != 0 {
+		t.Fatal("删除附件后应删除摘要记录")
+	}
+}
@@ -0,0 +1,125 @@
+package files_test
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+
+	"Gin-ZJUST/apptest"
+	"Gin-ZJUST/server"
+)
+
+func new_fake_s3(t *testing.T) (*httptest.Server, map[string][]byte) {
+	// 模拟 S3 兼容的对象存储（如 MinIO），只接受存储桶 zjust 中带签名的请求
+	var mu sync.Mutex
+	objects := map[string][]byte{}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		credential := r.URL.Query().Get("X-Amz-Credential")
+		if auth := r.Header.Get("Authorization"); auth != "" {
+			credential = strings.TrimPrefix(strings.Split(auth, ",")[0], "AWS4-HMAC-SHA256 Credential=")
+		} else if r.URL.Query().Get("X-Amz-Signature") == "" {
+			credential = ""
+		}
+		if !strings.HasPrefix(credential, "minio/") || !strings.HasSuffix(credential, "/us-east-1/s3/aws4_request") {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		key, ok := strings.CutPrefix(r.URL.Path, "/zjust")
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		switch r.Method {
+		case http.MethodHead:
+		case http.MethodPut:
+			body, _ := io.ReadAll(r.Body)
+			objects[key] = body
+		case http.MethodGet:
+			body, ok := objects[key]
+			if !ok {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			if v := r.URL.Query().Get("response-content-type"); v != "" {
+				w.Header().Set("Content-Type", v)
+			}
+			if v := r.URL.Query().Get("response-content-disposition"); v != "" {
+				w.Header().Set("Content-Disposition", v)
+			}
+			w.Write(body)
+		case http.MethodDelete:
+			delete(objects, key)
+			w.WriteHeader(http.StatusNoContent)
+		}
+	}))
+	t.Cleanup(ts.Close)
+	return ts, objects
+}
+
+func TestS3Storage(t *testing.T) {
+	for _, presign := range []bool{false, true} {
+		t.Run(fmt.Sprintf("presign=%v", presign), func(t *testing.T) {
+			ts, objects := new_fake_s3(t)
+			s := apptest.New_server(t, func(c *server.Config) {
+				c.Storage.Kind = "s3"
+				c.Storage.Endpoint = ts.URL
+				c.Storage.Bucket = "zjust"
+				c.Storage.AccessKey = "minio"
+				c.Storage.SecretKey = "minio123"
+				c.Storage.Presign = presign
+			})
+			anon := apptest.Anon(t, s)
+			if w := anon.Get("/readyz"); w.Code != http.StatusOK {
+				t.Fatalf("/readyz 返回 %d：%s", w.Code, w.Body.String())
+			}
+			stu := apptest.Login(t, s, "stuA")
+			id := apptest.Apply(t, s, stu, "学生附件")
+			attachmentID := apptest.Attachment_of(s, "appliance", id)
+			if len(objects) != 1 || string(objects["/"+apptest.Content_key("学生附件")]) != "学生附件" {
+				t.Fatalf("附件应保存到对象存储：%v", objects)
+			}
+			if _, err := os.Stat(s.Upload_root + "files"); !os.IsNotExist(err) {
+				t.Fatal("使用对象存储时不应写入附件目录")
+			}
+
+			w := stu.Get("/get_file?id=" + attachmentID)
+			if presign {
+				// 重定向到带签名的临时链接，由对象存储按记录的类型返回
+				link := w.Header().Get("Location")
+				if w.Code != http.StatusFound || !strings.HasPrefix(link, ts.URL+"/zjust/"+apptest.Content_key("学生附件")+"?") || !strings.Contains(link, "X-Amz-Signature=") {
+					t.Fatalf("应重定向到临时链接：%d %s", w.Code, link)
+				}
+				resp, err := http.Get(link)
+				if err != nil {
+					t.Fatal(err)
+				}
+				body, _ := io.ReadAll(resp.Body)
+				resp.Body.Close()
+				if string(body) != "学生附件" || resp.Header.Get("Content-Type") != "text/plain" || !strings.Contains(resp.Header.Get("Content-Disposition"), "attachment") {
+					t.Fatalf("临时链接下载有误：%s %v", body, resp.Header)
+				}
+			} else if w.Code != http.StatusOK || w.Body.String() != "学生附件" || w.Header().Get("Content-Type") != "text/plain" {
+				t.Fatalf("下载附件有误：%d %s %v", w.Code, w.Body.String(), w.Header())
+			}
+			if w := apptest.Login(t, s, "stuB").Get("/get_file?id=" + attachmentID); w.Code != http.StatusNotFound {
+				t.Fatalf("其他学生不应能下载：%d", w.Code)
+			}
+
+			apptest.Expect_body(t, stu.Get(fmt.Sprintf("/delete_appliance?applianceID=%d", id)), "删除成功！")
+			if len(objects) != 0 {
+				t.Fatalf("撤回申请后应删除对象存储中的附件：%v", objects)
+			}
+			ts.Close()
+			if w := anon.Get("/readyz"); w.Code != http.StatusServiceUnavailable {
+				t.Fatalf("对象存储不可用时 /readyz 返回 %d", w.Code)
+			}
+		})
+	}
+}
@@ -0,0 +1,29 @@
+package health
+
+import (
+	"net/http"
+
+	"Gin-ZJUST/server"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 供负载均衡、容器编排使用的存活检查与就绪检查，无需登录
+
+func Register(s *server.Server) {
+	r := s.Router
+
+	r.GET("/healthz", func(c *gin.Context) {
+		// 进程能够响应请求即视为存活
+		c.JSON(http.StatusOK, gin.H{"status": "ok"})
+	})
+
+	r.GET("/readyz", func(c *gin.Context) {
+		// 数据库、附件目录均可用且服务未在停止中时才接收流量
+		if err := s.Ready(); err != nil {
+			c.JSON(http.StatusServiceUnavailable, gin.H{"status": "unavailable", "error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"status": "ok"})
+	})
+}
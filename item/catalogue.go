@@ -0,0 +1,201 @@
+package item
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"Gin-ZJUST/server"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 项目目录：学生按名称与内容、类型、创建组织、分值范围、是否接受申请查找可申请的项目，分页、排序显示
+
+var catalogue_sorts = map[string]string{ // 排序方式 to 排序字段
+	"time":  "item.time_unix",
+	"name":  "item.name",
+	"score": "item.score_higher_range",
+	"org":   "org_name",
+}
+
+const catalogue_per_page = 20
+
+func score_param(c *gin.Context, name string) (float64, bool) {
+	// 分值须为有限的数字，NaN、Inf 无法写入 SQL，与格式有误时一样视为未填写
+	v, err := strconv.ParseFloat(c.Query(name), 64)
+	return v, err == nil && !math.IsNaN(v) && !math.IsInf(v, 0)
+}
+
+func catalogue_filter(c *gin.Context) (string, url.Values) {
+	// 根据查询参数生成 SQL 条件，同时返回规范化后的参数，用于生成翻页、排序链接和回填表单
+	conds := []string{server.Catalogue_items}
+	q := url.Values{}
+	if keyword := strings.TrimSpace(c.Query("q")); keyword != "" {
+		// 使用 instr 而不是 LIKE，关键词中的 % 和 _ 按原样匹配
+		k := server.Join_strs([]string{keyword})
+		conds = append(conds, fmt.Sprintf("(instr(item.name,%s)>0 OR instr(item.description,%s)>0)", k, k))
+		q.Set("q", keyword)
+	}
+	switch c.Query("type") {
+	case "2":
+		// 第二课堂：基础项目 0，非基础项目 2
+		conds = append(conds, "item.type IN (0,2)")
+		q.Set("type", "2")
+	case "3":
+		conds = append(conds, "item.type IN (1,3)")
+		q.Set("type", "3")
+	}
+	switch c.Query("kind") {
+	case "basic":
+		conds = append(conds, "item.type IN (0,1)")
+		q.Set("kind", "basic")
+	case "activity":
+		conds = append(conds, "item.type IN (2,3)")
+		q.Set("kind", "activity")
+	}
+	if orgID, err := strconv.ParseInt(c.Query("org"), 10, 64); err == nil {
+		conds = append(conds, fmt.Sprintf("item.create_org=%d", orgID))
+		q.Set("org", strconv.FormatInt(orgID, 10))
+	}
+	// 分值范围与 [min_score, max_score] 有交集的项目
+	if min_score, ok := score_param(c, "min_score"); ok {
+		conds = append(conds, fmt.Sprintf("item.score_higher_range>=%g", min_score))
+		q.Set("min_score", c.Query("min_score"))
+	}
+	if max_score, ok := score_param(c, "max_score"); ok {
+		conds = append(conds, fmt.Sprintf("item.score_lower_range<=%g", max_score))
+		q.Set("max_score", c.Query("max_score"))
+	}
+	switch c.Query("open") {
+	case "1":
+		conds = append(conds, "item_closed.itemID IS NULL")
+		q.Set("open", "1")
+	case "0":
+		conds = append(conds, "item_closed.itemID IS NOT NULL")
+		q.Set("open", "0")
+	}
+	return strings.Join(conds, " AND "), q
+}
+
+func catalogue_link(q url.Values, changes ...string) string {
+	// 在当前查询参数的基础上修改若干参数（名称、值交替给出），生成目录页链接
+	res := url.Values{}
+	for k, v := range q {
+		res[k] = v
+	}
+	for i := 0; i+1 < len(changes); i += 2 {
+		res.Set(changes[i], changes[i+1])
+	}
+	return "/apply.html?" + res.Encode()
+}
+
+func catalogue(s *server.Server, c *gin.Context) error {
+	cond, q := catalogue_filter(c)
+	sort := c.Query("sort")
+	if _, ok := catalogue_sorts[sort]; !ok {
+		sort = "time"
+	}
+	order := "desc"
+	if c.Query("order") == "asc" {
+		order = "asc"
+	}
+	page, err := strconv.Atoi(c.Query("page"))
+	if err != nil || page < 1 {
+		page = 1
+	}
+
+	from := "FROM item LEFT JOIN organization ON item.create_org=organization.orgID LEFT JOIN item_closed ON item.itemID=item_closed.itemID WHERE " + cond
+	count, err := s.Query_one("SELECT COUNT(*) AS n " + from + ";")
+	if err != nil {
+		return err
+	}
+	total, ok := count["n"].(int64)
+	if !ok {
+		return server.Internal(fmt.Errorf("项目数量类型有误：%T", count["n"]))
+	}
+	pages := max(1, (total+catalogue_per_page-1)/catalogue_per_page)
+	if int64(page) > pages {
+		page = int(pages)
+	}
+	sql := fmt.Sprintf("SELECT item.*,organization.name AS org_name,item_closed.itemID IS NULL AS open %s ORDER BY %s %s,item.itemID %s LIMIT %d OFFSET %d;",
+		from, catalogue_sorts[sort], order, order, catalogue_per_page, (page-1)*catalogue_per_page)
+	items := s.Query(sql)
+	for _, item := range items {
+		item["kind"] = "基础项目"
+		if item["type"].(int64) >= 2 {
+			item["kind"] = "非基础项目"
+		}
+		item["type"] = server.Item_types[item["type"].(int64)]
+		item["open"] = item["open"] == int64(1)
+		if t, _ := item["time_unix"].(int64); t > 0 {
+			item["time"] = time.Unix(t, 0).Format("2006-01-02")
+		}
+	}
+
+	// 排序链接：按时间默认从新到旧，其余默认升序；再次点击当前排序字段时切换升降序
+	sorts := gin.H{}
+	for name := range catalogue_sorts {
+		next := "asc"
+		if name == sort && order == "asc" || name != sort && name == "time" {
+			next = "desc"
+		}
+		sorts[name] = catalogue_link(q, "sort", name, "order", next)
+	}
+	q.Set("sort", sort)
+	q.Set("order", order)
+	data := gin.H{
+		"msg":    "",
+		"items":  items,
+		"total":  total,
+		"page":   page,
+		"pages":  pages,
+		"sorts":  sorts,
+		"filter": gin.H{"q": q.Get("q"), "type": q.Get("type"), "kind": q.Get("kind"), "org": q.Get("org"), "min_score": q.Get("min_score"), "max_score": q.Get("max_score"), "open": q.Get("open")},
+		"orgs":   s.Query("SELECT DISTINCT organization.orgID AS orgID,organization.name AS name FROM item,organization WHERE item.create_org=organization.orgID AND " + server.Catalogue_items + " ORDER BY organization.orgID;"),
+	}
+	if page > 1 {
+		data["prev"] = catalogue_link(q, "page", strconv.Itoa(page-1))
+	}
+	if int64(page) < pages {
+		data["next"] = catalogue_link(q, "page", strconv.Itoa(page+1))
+	}
+	c.HTML(http.StatusOK, "apply.html", data)
+	return nil
+}
+
+func set_open(s *server.Server, c *gin.Context) error {
+	// 停止或恢复项目的申请：基础项目由超级管理员操作，非基础项目由创建组织具有立项权限的管理员操作
+	itemID, err := strconv.ParseInt(c.PostForm("itemID"), 10, 64)
+	if err != nil {
+		return server.Err_bad_request
+	}
+	item, err := s.Query_one(fmt.Sprintf("SELECT * FROM item WHERE itemID=%d;", itemID))
+	if err != nil {
+		return err
+	}
+	basic := item["type"].(int64) < 2
+	if basic && c.GetInt64("account_type") != 0 {
+		return server.Err_forbidden
+	} else if !basic && (item["create_org"] != c.GetInt64("belonging_org") || s.User_authorities(c.GetString("userID"), c.GetInt64("account_type"))&server.Perm_add_item == 0) {
+		return server.Err_forbidden
+	}
+	if c.PostForm("open") == "1" {
+		_, err = s.DB.Exec("DELETE FROM item_closed WHERE itemID=?;", itemID)
+	} else {
+		_, err = s.DB.Exec("INSERT OR IGNORE INTO item_closed VALUES(?,?,?);", itemID, c.GetString("userID"), time.Now().Unix())
+	}
+	if err != nil {
+		return err
+	}
+	if basic {
+		c.Redirect(http.StatusFound, "/add_basic_item.html")
+	} else {
+		c.Redirect(http.StatusFound, fmt.Sprintf("/added_item_detail?itemID=%d", itemID))
+	}
+	return nil
+}
@@ -0,0 +1,140 @@
+package item_test
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"Gin-ZJUST/apptest"
+)
+
+func TestItemCatalogue(t *testing.T) {
+	s := apptest.New_server(t)
+	for _, sql := range []string{
+		"INSERT INTO item VALUES(2,2,4,'学院讲座',2,3,3,'学术讲座',200,'[]');",
+		"INSERT INTO item VALUES(3,3,1,'待审活动',1,2,3,'尚未审核',300,'[]');",
+		"INSERT INTO item VALUES(4,1,0,'社会实践',5,8,1,'暑期 100% 参与',400,'');",
+	} {
+		s.Exec(sql)
+	}
+	stu := apptest.Login(t, s, "stuA")
+	w := stu.Get("/apply.html")
+	apptest.Expect_body(t, w, "学院讲座")
+	if strings.Contains(w.Body.String(), "待审活动") {
+		t.Fatal("未审核通过的非基础项目不应出现在项目目录中")
+	}
+	apptest.Expect_body(t, w, "共 3 个项目")
+
+	// 按关键词、类型、创建单位、分值和申请状态筛选
+	for query, want := range map[string]string{
+		"q=讲座":                    "学院讲座",
+		"q=100%25":                "社会实践",
+		"type=3":                  "社会实践",
+		"kind=activity":           "学院讲座",
+		"org=3":                   "学院讲座",
+		"min_score=5":             "社会实践",
+		"min_score=1&max_score=1": "志愿服务",
+	} {
+		w := stu.Get("/apply.html?" + query)
+		apptest.Expect_body(t, w, "共 1 个项目")
+		apptest.Expect_body(t, w, want)
+	}
+	apptest.Expect_body(t, stu.Get("/apply.html?q=%25"), "共 1 个项目")
+	// 分值不是有限的数字时视为未填写
+	for _, query := range []string{"min_score=NaN", "max_score=-Inf", "min_score=Infinity&max_score=1e400"} {
+		w := stu.Get("/apply.html?" + query)
+		apptest.Expect_body(t, w, "共 3 个项目")
+		if strings.Contains(w.Body.String(), "NaN") || strings.Contains(w.Body.String(), "Inf") {
+			t.Fatalf("%s 不应回填到表单中", query)
+		}
+	}
+
+	// 排序与分页
+	for i := 0; i < 25; i++ {
+		s.Exec(fmt.Sprintf("INSERT INTO item VALUES(NULL,0,0,'项目%02d',1,2,1,'',%d,'');", i, 1000+i))
+	}
+	w = stu.Get("/apply.html?sort=name&order=asc")
+	apptest.Expect_body(t, w, "第 1 / 2 页")
+	body := w.Body.String()
+	if strings.Index(body, "学院讲座") > strings.Index(body, "项目00") || strings.Contains(body, "项目24") {
+		t.Fatal("按名称升序时第一页应依次显示学院讲座、项目00…")
+	}
+	apptest.Expect_body(t, w, "page=2")
+	w = stu.Get("/apply.html?sort=name&order=asc&page=2")
+	apptest.Expect_body(t, w, "第 2 / 2 页")
+	apptest.Expect_body(t, w, "项目24")
+	if strings.Contains(w.Body.String(), "项目00") {
+		t.Fatal("第二页不应包含第一页的项目")
+	}
+	apptest.Expect_body(t, stu.Get("/apply.html"), "项目24")
+
+	// 停止申请：基础项目由超级管理员操作，非基础项目由创建组织操作；只接受 POST
+	set_open := func(c *apptest.Client, itemID int, open int) int {
+		return c.Post("/set_item_open", url.Values{"itemID": {fmt.Sprint(itemID)}, "open": {fmt.Sprint(open)}}).Code
+	}
+	if code := set_open(apptest.Login(t, s, "collegeA"), 1, 0); code != http.StatusForbidden {
+		t.Fatalf("学院管理员不应能停止基础项目的申请：%d", code)
+	}
+	if code := set_open(apptest.Login(t, s, "collegeB"), 2, 0); code != http.StatusForbidden {
+		t.Fatalf("其他学院不应能停止本项目的申请：%d", code)
+	}
+	root := apptest.Login(t, s, "root")
+	if w := root.Get("/set_item_open?itemID=1&open=0"); w.Code == http.StatusFound || !s.Item_open(1) {
+		t.Fatalf("不应能通过 GET 停止申请：%d", w.Code)
+	}
+	if code := set_open(root, 1, 0); code != http.StatusFound {
+		t.Fatalf("停止申请失败：%d", code)
+	}
+	apptest.Expect_body(t, root.Get("/add_basic_item.html"), `name="open" value="1"`)
+	college := apptest.Login(t, s, "collegeA")
+	if code := set_open(college, 2, 0); code != http.StatusFound {
+		t.Fatalf("停止申请失败：%d", code)
+	}
+	apptest.Expect_body(t, college.Get("/added_item_detail?itemID=2"), "已停止申请")
+	w = stu.Get("/apply.html?open=0")
+	apptest.Expect_body(t, w, "共 2 个项目")
+	apptest.Expect_body(t, w, "志愿服务")
+	apptest.Expect_body(t, stu.Get("/item_info?itemID=1"), "该项目已停止申请")
+	apptest.Expect_body(t, stu.Upload("/apply_item?ID=1", url.Values{}, "证明.txt", "证明"), "该项目已停止申请！")
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/appliances", strings.NewReader(`{"itemID":2}`))
+	req.Header.Set("Content-Type", "application/json")
+	if w := stu.Do(req); w.Code != http.StatusConflict {
+		t.Fatalf("接口申请已停止申请的项目应返回 409：%d", w.Code)
+	}
+	if len(s.Query("SELECT * FROM appliance;")) != 0 {
+		t.Fatal("不应保存已停止申请项目的申请")
+	}
+
+	// 未审核通过的非基础项目不能查看、申请；恢复申请后可以申请
+	apptest.Expect_body(t, stu.Get("/item_info?itemID=3"), "项目不存在！")
+	if w := stu.Upload("/apply_item?ID=3", url.Values{}, "证明.txt", "证明"); w.Code != http.StatusNotFound {
+		t.Fatalf("不应能申请未审核通过的项目：%d", w.Code)
+	}
+	set_open(college, 2, 1)
+	apptest.Expect_body(t, stu.Upload("/apply_item?ID=2", url.Values{}, "证明.txt", "证明"), "申请成功！")
+
+	// 重新导入学生名单只替换上次导入的记录，学生自己的申请及附件保留
+	own := s.Query("SELECT applianceID FROM appliance WHERE itemID=2;")[0]["applianceID"].(int64)
+	for i := 0; i < 2; i++ {
+		apptest.Expect_body(t, college.Post("/import_student_list?itemID=2", url.Values{"list": {`[{"ID":"stuB","score":1}]`}}), "共导入 1 条，其中导入失败 0 条。")
+	}
+	if n := len(s.Query("SELECT * FROM appliance WHERE itemID=2 AND description='导入项目';")); n != 1 {
+		t.Fatalf("重新导入后应只有一条导入记录：%d", n)
+	}
+	if apptest.Status_of(s, "appliance", own) == -1 || apptest.Attachment_of(s, "appliance", own) == "" {
+		t.Fatal("导入学生名单删除了学生自己的申请")
+	}
+
+	// 删除基础项目时一并删除其停止申请记录
+	set_open(root, 4, 0)
+	apptest.Expect_body(t, root.Get("/delete_basic_item?name="+url.QueryEscape("社会实践")), "删除成功！")
+	if len(s.Query("SELECT * FROM item WHERE itemID=4;")) != 0 || len(s.Query("SELECT * FROM item_closed WHERE itemID=4;")) != 0 {
+		t.Fatal("删除基础项目后仍有项目或停止申请记录")
+	}
+	if s.Item_open(1) {
+		t.Fatal("删除其他基础项目不应影响志愿服务的申请状态")
+	}
+}
@@ -0,0 +1,320 @@
+package item
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"Gin-ZJUST/files"
+	"Gin-ZJUST/server"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 基础项目维护、学生浏览项目，以及单位、学院的非基础项目立项与学生名单导入
+func Register(s *server.Server) {
+	r := s.Router
+
+	r.GET("/add_basic_item.html", s.Midware_Auth, s.Authorities(0b000001), func(c *gin.Context) {
+		userID := c.GetString("userID")
+		c.HTML(http.StatusOK, "add_basic_item.html", gin.H{
+			"msg":   "welcome, " + userID,
+			"added": basic_items(s),
+		})
+	})
+	r.POST("/add_basic_item", s.Midware_Auth, s.Authorities(0b000001), s.Handle(func(c *gin.Context) error {
+		item_name := c.PostForm("name")
+		var msg string
+		sql := fmt.Sprintf("SELECT * FROM item WHERE name=\"%s\";", item_name)
+		query_res := s.Query(sql)
+		if len(query_res) == 0 {
+			score_lower_range, _ := strconv.ParseFloat(c.PostForm("score_lower_range"), 64)
+			score_higher_range, _ := strconv.ParseFloat(c.PostForm("score_higher_range"), 64)
+			tp, err := strconv.ParseInt(c.PostForm("type"), 10, 64)
+			if err != nil {
+				return server.Err_bad_request
+			}
+			orgID := c.GetInt64("belonging_org")
+			description := c.PostForm("description")
+			sql = fmt.Sprintf("INSERT INTO item VALUES(NULL,%d,0,\"%s\",%.1f,%.1f,%d,\"%s\",%d,\"\");", tp, item_name, score_lower_range, score_higher_range, orgID, description, time.Now().Unix())
+			ok := s.Exec(sql)
+			if ok {
+				msg = "添加成功！"
+			} else {
+				msg = "添加失败，请重试"
+			}
+		} else {
+			msg = "添加失败。项目已存在！"
+		}
+		c.HTML(http.StatusOK, "add_basic_item.html", gin.H{
+			"msg":   msg,
+			"added": basic_items(s),
+		})
+		return nil
+	}))
+
+	r.GET("/delete_basic_item", s.Midware_Auth, s.Authorities(0b000001), func(c *gin.Context) {
+		// 只删除该名称的基础项目，连同其停止申请记录和附件
+		to_delete := c.Query("name")
+		ids := []int64{}
+		for _, item := range s.Query(fmt.Sprintf("SELECT itemID FROM item WHERE name=%s AND type IN (0,1);", server.Join_strs([]string{to_delete}))) {
+			ids = append(ids, item["itemID"].(int64))
+		}
+		s.Exec(fmt.Sprintf("DELETE FROM item_closed WHERE itemID IN (%s);", server.Join_ids(ids)))
+		s.Exec(fmt.Sprintf("DELETE FROM item WHERE itemID IN (%s);", server.Join_ids(ids)))
+		files.Remove(s, files.Owner_item, ids)
+		c.HTML(http.StatusOK, "add_basic_item.html", gin.H{
+			"msg":   "删除成功！",
+			"added": basic_items(s),
+		})
+
+	})
+
+	r.GET("/apply.html", s.Midware_Auth, s.Authorities(0b100000), s.Handle(func(c *gin.Context) error {
+		return catalogue(s, c)
+	}))
+
+	r.GET("/item_info", s.Midware_Auth, s.Authorities(0b100000), func(c *gin.Context) {
+		// 只能查看目录中的项目
+		itemID, _ := strconv.Atoi(c.Query("itemID"))
+		sql := fmt.Sprintf("SELECT * from item WHERE itemID=%d AND %s", itemID, server.Catalogue_items)
+		msg := ""
+		item := s.Query(sql)
+		if len(item) == 0 {
+			msg = "项目不存在！"
+			c.HTML(http.StatusOK, "item_info.html", gin.H{
+				"msg": msg,
+			})
+		} else {
+			create_orgID, _ := item[0]["create_org"].(int64)
+			item[0]["create_org"] = s.Org_name(create_orgID)
+			item[0]["type"] = server.Item_types[item[0]["type"].(int64)]
+			c.HTML(http.StatusOK, "item_info.html", gin.H{
+				"msg":  msg,
+				"item": item[0],
+				"open": s.Item_open(int64(itemID)),
+			})
+		}
+	})
+
+	r.GET("/add_item.html", s.Midware_Auth, s.Authorities(0b001100), s.Permission(server.Perm_add_item), func(c *gin.Context) {
+		orgID := c.GetInt64("belonging_org")
+		sql := fmt.Sprintf("SELECT * FROM item WHERE create_org=%d", orgID)
+		items := s.Query(sql)
+		for _, item := range items {
+			item["status"] = server.Item_status[item["status"].(int64)]
+			item["type"] = server.Item_types[item["type"].(int64)]
+		}
+		c.HTML(http.StatusOK, "add_item.html", gin.H{
+			"added": items,
+		})
+	})
+
+	r.POST("/add_activity_item", s.Midware_Auth, s.Authorities(0b001100), s.Permission(server.Perm_add_item), files.Limit(s), s.Handle(func(c *gin.Context) error {
+		userID := c.GetString("userID")
+		var msg string
+		name := c.PostForm("name")
+		orgID := c.GetInt64("belonging_org")
+		sql := fmt.Sprintf("SELECT * FROM item WHERE name=\"%s\";", name)
+		if len(s.Query(sql)) == 0 {
+			tp, err := strconv.ParseInt(c.PostForm("type"), 10, 64)
+			if err != nil || (tp != 2 && tp != 3) {
+				return server.Err_bad_request
+			}
+			score_lower_range, _ := strconv.ParseFloat(c.PostForm("score_lower_range"), 64)
+			score_higher_range, _ := strconv.ParseFloat(c.PostForm("score_higher_range"), 64)
+			description := c.PostForm("description")
+			time := int(time.Now().Unix())
+			record := []map[string]any{}
+			temp := map[string]any{
+				"operator":  userID,
+				"time":      strconv.Itoa(time),
+				"operation": "添加项目：" + name,
+			}
+			record = append(record, temp)
+			json, _ := json.Marshal(record)
+			sql = fmt.Sprintf("INSERT INTO item VALUES(NULL,%d,1,\"%s\", %.2f, %.2f, %d,\"%s\",%d,'%s');", tp, name, score_lower_range, score_higher_range, orgID, description, time, string(json))
+			res, err := s.DB.Exec(sql)
+			if err != nil {
+				s.Log_db_error(c, "添加项目失败", sql, err)
+				msg = "添加失败。"
+			} else {
+				itemID, _ := res.LastInsertId()
+				quarantined, err := files.Save(s, c, files.Owner_item, itemID)
+				if err != nil {
+					// 附件不合要求时撤回立项
+					s.Exec(fmt.Sprintf("DELETE FROM item WHERE itemID=%d;", itemID))
+					if server.As_error(err).Status >= http.StatusInternalServerError {
+						return err
+					}
+					msg = "添加失败：" + err.Error()
+				} else {
+					msg = "添加成功！" + files.Quarantine_msg(quarantined)
+				}
+			}
+		} else {
+			msg = "添加失败：项目名称重复。"
+		}
+
+		sql = fmt.Sprintf("SELECT * FROM item WHERE create_org=%d", orgID)
+		items := s.Query(sql)
+		for _, item := range items {
+			item["status"] = server.Item_status[item["status"].(int64)]
+			item["type"] = server.Item_types[item["type"].(int64)]
+		}
+		c.HTML(http.StatusOK, "add_item.html", gin.H{
+			"msg":   msg,
+			"added": items,
+		})
+		return nil
+	}))
+
+	r.GET("/added_item_detail", s.Midware_Auth, s.Authorities(0b001100), s.Permission(server.Perm_add_item), s.Handle(func(c *gin.Context) error {
+		item, err := own_item(s, c)
+		if err != nil {
+			return err
+		}
+		itemID := item["itemID"].(int64)
+		create_org := item["create_org"].(int64)
+		item["create_org"] = s.Org_name(create_org)
+		item["status"] = server.Item_status[item["status"].(int64)]
+
+		paths := files.List(s, files.Owner_item, itemID)
+
+		record_str, _ := item["record"].(string)
+		records := []map[string]any{}
+		json.Unmarshal([]byte(record_str), &records)
+
+		list := []map[string]any{}
+		if status := item["status"]; status == "预审核通过" || status == "审核通过" || status == "审核不通过" {
+			list = s.Query(fmt.Sprintf("SELECT * FROM appliance WHERE itemID=%d;", itemID))
+			for _, ap := range list {
+				ap["status"] = server.Appliance_status[ap["status"].(int64)]
+			}
+		}
+
+		c.HTML(http.StatusOK, "added_item_detail.html", gin.H{
+			"item":    item,
+			"paths":   paths,
+			"records": records,
+			"list":    list,
+			"open":    s.Item_open(itemID),
+		})
+		return nil
+	}))
+
+	r.POST("/set_item_open", s.Midware_Auth, s.Authorities(0b001101), s.Handle(func(c *gin.Context) error {
+		// open=1 恢复申请，否则停止申请
+		return set_open(s, c)
+	}))
+
+	r.POST("/import_student_list", s.Midware_Auth, s.Authorities(0b001100), s.Permission(server.Perm_add_item), s.Handle(func(c *gin.Context) error {
+		list := c.PostForm("list")
+		students := []map[string]any{}
+		if err := json.Unmarshal([]byte(list), &students); err != nil {
+			return server.Err_bad_request
+		}
+		item, err := own_item(s, c)
+		if err != nil {
+			return err
+		}
+		userID := c.GetString("userID")
+		itemID := item["itemID"].(int64)
+		create_org := item["create_org"].(int64)
+
+		// 重新导入时只替换上次导入的记录，学生自己提交的申请及其附件保留
+		failed := 0
+		imported := []int64{}
+		for _, ap := range s.Query(fmt.Sprintf("SELECT applianceID FROM appliance WHERE itemID=%d AND description='导入项目';", itemID)) {
+			imported = append(imported, ap["applianceID"].(int64))
+		}
+		files.Remove(s, files.Owner_appliance, imported)
+		sql := fmt.Sprintf("DELETE FROM appliance WHERE applianceID IN (%s);", server.Join_ids(imported))
+		s.Exec(sql)
+		for _, stu := range students {
+			// 学号须为字符串、记点须为数字，格式有误的条目计为导入失败
+			stuID, ok := stu["ID"].(string)
+			score, ok2 := stu["score"].(float64)
+			if !ok || !ok2 {
+				failed++
+				continue
+			}
+			sql = fmt.Sprintf("SELECT * FROM user WHERE userID=\"%s\";", stuID)
+			query_res := s.Query(sql)
+			if len(query_res) == 0 {
+				failed++
+				continue
+			}
+			sql = fmt.Sprintf("INSERT INTO appliance VALUES(NULL,%d,\"%s\", %.2f, 0, '[]', %d, '导入项目');", itemID, stuID, score, time.Now().Unix())
+			if s.Exec(sql) {
+				s.Metrics.Appliance_created("import")
+			} else {
+				failed++
+			}
+		}
+		msg := fmt.Sprintf("共导入 %d 条，其中导入失败 %d 条。", len(students), failed)
+
+		item["create_org"] = s.Org_name(create_org)
+		item["status"] = server.Item_status[item["status"].(int64)]
+
+		record_str, _ := item["record"].(string)
+		records := []map[string]any{}
+		json.Unmarshal([]byte(record_str), &records)
+
+		new_record := map[string]any{
+			"operator":  userID,
+			"time":      strconv.Itoa(int(time.Now().Unix())),
+			"operation": fmt.Sprintf("导入 %d 条学生信息，其中导入失败 %d 条。", len(students), failed),
+		}
+
+		records = append(records, new_record)
+		record_str_t, _ := json.Marshal(records)
+		sql = fmt.Sprintf("UPDATE item SET record='%s' WHERE itemID=%d", string(record_str_t), itemID)
+		s.Exec(sql)
+
+		ls := []map[string]any{}
+		if status := item["status"]; status == "预审核通过" || status == "审核通过" || status == "审核不通过" {
+			ls = s.Query(fmt.Sprintf("SELECT * FROM appliance WHERE itemID=%d;", itemID))
+			for _, ap := range ls {
+				ap["status"] = server.Appliance_status[ap["status"].(int64)]
+			}
+		}
+
+		c.HTML(http.StatusOK, "added_item_detail.html", gin.H{
+			"msg":     msg,
+			"item":    item,
+			"records": records,
+			"list":    ls,
+			"open":    s.Item_open(itemID),
+		})
+		return nil
+	}))
+}
+
+func basic_items(s *server.Server) []map[string]any {
+	// 全部基础项目，以及是否接受申请（open）
+	items := s.Query("SELECT item.*,item_closed.itemID IS NULL AS open FROM item LEFT JOIN item_closed ON item.itemID=item_closed.itemID WHERE item.type=0 OR item.type=1;")
+	for _, item := range items {
+		item["type"] = server.Item_types[item["type"].(int64)]
+		item["open"] = item["open"] == int64(1)
+	}
+	return items
+}
+
+func own_item(s *server.Server, c *gin.Context) (map[string]any, error) {
+	// 查询本组织立项的项目，其他组织的项目返回 Err_forbidden
+	itemID, err := strconv.ParseInt(c.Query("itemID"), 10, 64)
+	if err != nil {
+		return nil, server.Err_bad_request
+	}
+	item, err := s.Query_one(fmt.Sprintf("SELECT * FROM item WHERE itemID=%d", itemID))
+	if err != nil {
+		return nil, err
+	}
+	if create_org, _ := item["create_org"].(int64); create_org != c.GetInt64("belonging_org") {
+		return nil, server.Err_forbidden
+	}
+	return item, nil
+}
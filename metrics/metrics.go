@@ -0,0 +1,30 @@
+package metrics
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+
+	"Gin-ZJUST/server"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// 以 Prometheus 文本格式导出监控指标；抓取时须在请求头中携带配置的 Bearer 令牌，未配置令牌时不提供
+
+func Register(s *server.Server) {
+	if s.Config.MetricsToken == "" {
+		return
+	}
+	h := promhttp.HandlerFor(s.Metrics.Registry, promhttp.HandlerOpts{})
+	s.Router.GET("/metrics", func(c *gin.Context) {
+		token, ok := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(s.Config.MetricsToken)) != 1 {
+			c.Header("WWW-Authenticate", `Bearer realm="metrics"`)
+			c.String(http.StatusUnauthorized, "未授权")
+			return
+		}
+		h.ServeHTTP(c.Writer, c.Request)
+	})
+}
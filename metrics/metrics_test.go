@@ -0,0 +1,56 @@
+package metrics_test
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"Gin-ZJUST/apptest"
+	"Gin-ZJUST/server"
+)
+
+func TestMetrics(t *testing.T) {
+	// 未配置令牌时不提供监控指标
+	s := apptest.New_server(t)
+	anon := apptest.Anon(t, s)
+	if w := anon.Get("/metrics"); w.Code != http.StatusNotFound {
+		t.Fatalf("未配置令牌时 /metrics 应返回404：%d", w.Code)
+	}
+
+	s = apptest.New_server(t, func(c *server.Config) { c.MetricsToken = "m-token" })
+	stu := apptest.Login(t, s, "stuA")
+	id := apptest.Apply(t, s, stu, "证明材料")
+	branch := apptest.Login(t, s, "branchA")
+	branch.Post(fmt.Sprintf("/audit_basic_item?applianceID=%d", id), url.Values{"option": {"1"}, "opinion": {"同意"}})
+	s.Metrics.Appliance_audited(2, false, 1)
+
+	anon = apptest.Anon(t, s)
+	scrape := func(auth string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+		if auth != "" {
+			req.Header.Set("Authorization", auth)
+		}
+		return anon.Do(req)
+	}
+	for _, auth := range []string{"", "Bearer wrong", "m-token"} {
+		if w := scrape(auth); w.Code != http.StatusUnauthorized || strings.Contains(w.Body.String(), "zjust_") {
+			t.Fatalf("令牌 %q 不应能抓取监控指标：%d", auth, w.Code)
+		}
+	}
+	w := scrape("Bearer m-token")
+	for _, want := range []string{
+		`zjust_appliances_created_total{source="apply"} 1`,
+		`zjust_appliance_audits_total{level="branch",result="approved"} 1`,
+		`zjust_appliance_audits_total{level="other",result="rejected"} 1`,
+		`zjust_pending_appliances{level="branch"} 0`,
+		`zjust_pending_appliances{level="college"} 1`,
+		`zjust_active_sessions 2`,
+		fmt.Sprintf(`zjust_upload_bytes_total{kind="appliance"} %d`, len("证明材料")),
+		`zjust_http_request_duration_seconds_count{method="POST",route="/apply_item",status="200"} 1`,
+	} {
+		apptest.Expect_body(t, w, want)
+	}
+}
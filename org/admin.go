@@ -0,0 +1,226 @@
+package org
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"Gin-ZJUST/server"
+
+	"github.com/gin-gonic/gin"
+)
+
+func org_admins(s *server.Server, orgID int64) []map[string]any {
+	// 查询组织的全部管理员及其被授予的功能，未受委派的管理员拥有全部功能
+	sql := fmt.Sprintf("SELECT user.userID AS userID,admin_permission.permissions AS permissions FROM user LEFT JOIN admin_permission ON user.userID=admin_permission.userID WHERE user.belonging_org=%d AND user.account_type!=5;", orgID)
+	admins := s.Query(sql)
+	for _, admin := range admins {
+		perms := []string{}
+		grants := []gin.H{} // 修改权限的表单，已授予的功能默认勾选
+		granted, delegated := admin["permissions"].(int64)
+		for _, p := range server.Delegable_permissions {
+			has := !delegated || int(granted)&p["bit"].(int) != 0
+			if has {
+				perms = append(perms, p["name"].(string))
+			}
+			grants = append(grants, gin.H{"bit": p["bit"], "name": p["name"], "granted": has})
+		}
+		admin["delegated"] = delegated
+		admin["permissions"] = perms
+		admin["grants"] = grants
+	}
+	return admins
+}
+
+func invite_admin(s *server.Server, inviter string, account_type int64, orgID int64, userID string, perms []int) error {
+	// 为本组织添加受委派的管理员，授予的功能不能超出邀请者自身的功能
+	if userID == "" {
+		return fmt.Errorf("用户名不能为空")
+	}
+	if len(s.Query(fmt.Sprintf("SELECT * FROM user WHERE userID=%s;", server.Join_strs([]string{userID})))) > 0 {
+		return fmt.Errorf("用户名重复")
+	}
+	granted := 0
+	for _, p := range perms {
+		granted |= p
+	}
+	granted &= s.User_authorities(inviter, account_type)
+
+	tx, err := s.DB.Beginx()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if _, err = tx.Exec("INSERT INTO user VALUES(?,?,?,?);", userID, s.Config.DefaultPasswd, account_type, orgID); err != nil {
+		return err
+	}
+	if _, err = tx.Exec("INSERT INTO admin_permission VALUES(?,?);", userID, granted); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func set_admin_permission(s *server.Server, setter string, account_type int64, orgID int64, userID string, perms []int) error {
+	// 修改本组织受委派的管理员的功能，同样不能超出修改者自身的功能；该管理员的SessionID在其下一次请求时更换
+	sql := fmt.Sprintf("SELECT * FROM user,admin_permission WHERE user.userID=admin_permission.userID AND user.userID=%s AND user.belonging_org=%d;", server.Join_strs([]string{userID}), orgID)
+	if len(s.Query(sql)) == 0 {
+		return fmt.Errorf("权限不足")
+	}
+	granted := 0
+	for _, p := range perms {
+		granted |= p
+	}
+	granted &= s.User_authorities(setter, account_type)
+	if _, err := s.DB.Exec("UPDATE admin_permission SET permissions=? WHERE userID=?;", granted, userID); err != nil {
+		return err
+	}
+	s.Sessions.Rotate_later(userID)
+	return nil
+}
+
+func remove_org_admin(s *server.Server, orgID int64, userID string) error {
+	// 删除本组织受委派的管理员，组织的默认管理员不可删除
+	sql := fmt.Sprintf("SELECT * FROM user,admin_permission WHERE user.userID=admin_permission.userID AND user.userID=%s AND user.belonging_org=%d;", server.Join_strs([]string{userID}), orgID)
+	if len(s.Query(sql)) == 0 {
+		return fmt.Errorf("权限不足")
+	}
+	tx, err := s.DB.Beginx()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if _, err = tx.Exec("DELETE FROM user WHERE userID=?;", userID); err != nil {
+		return err
+	}
+	if _, err = tx.Exec("DELETE FROM admin_permission WHERE userID=?;", userID); err != nil {
+		return err
+	}
+	if err = tx.Commit(); err != nil {
+		return err
+	}
+	s.Sessions.Logout(userID)
+	return nil
+}
+
+func register_admin(s *server.Server) {
+	// 超级管理员管理各级管理员账号，学院、团支部管理员管理本组织受委派的管理员
+	r := s.Router
+
+	r.GET("/create_new_manager.html", s.Midware_Auth, s.Authorities(0b000001), func(c *gin.Context) {
+		orgs := s.Query("SELECT orgID,name FROM organization;")
+		admins := s.Query("SELECT user.userID AS userID,user.account_type AS account_type, organization.name AS belonging_org FROM user,organization WHERE organization.orgID=user.belonging_org AND (account_type=1 OR account_type=2 OR account_type=3 OR account_type=4);")
+		for _, admin := range admins {
+			admin["account_type"] = server.Account_types[admin["account_type"].(int64)]
+		}
+		c.HTML(http.StatusOK, "create_new_manager.html", gin.H{
+			"msg":    "",
+			"orgs":   orgs,
+			"admins": admins,
+		})
+	})
+
+	r.POST("/create_new_manager", s.Midware_Auth, s.Authorities(0b000001), func(c *gin.Context) {
+		name := c.PostForm("name")
+		admin_type, _ := strconv.Atoi(c.PostForm("type"))
+		belonging_org, _ := strconv.Atoi(c.PostForm("belonging_org"))
+		sql := fmt.Sprintf("INSERT INTO user VALUES(\"%s\",\"%s\",%d,%d);", name, s.Config.DefaultPasswd, admin_type, belonging_org)
+		ok := s.Exec(sql)
+		orgs := s.Query("SELECT orgID,name FROM organization;")
+		admins := s.Query("SELECT user.userID AS userID,user.account_type AS account_type, organization.name AS belonging_org FROM user,organization WHERE organization.orgID=user.belonging_org AND (account_type=1 OR account_type=2 OR account_type=3 OR account_type=4);")
+		for _, admin := range admins {
+			admin["account_type"] = server.Account_types[admin["account_type"].(int64)]
+		}
+		var msg string
+		if ok {
+			msg = "添加成功！"
+		} else {
+			msg = "添加失败"
+		}
+		c.HTML(http.StatusOK, "create_new_manager.html", gin.H{
+			"msg":    msg,
+			"orgs":   orgs,
+			"admins": admins,
+		})
+	})
+
+	r.GET("/delete_admin", s.Midware_Auth, s.Authorities(0b000001), func(c *gin.Context) {
+		userID := c.Query("userID")
+		sql := fmt.Sprintf("DELETE FROM user WHERE userID=\"%s\"", userID)
+		ok := s.Exec(sql)
+		s.Exec(fmt.Sprintf("DELETE FROM admin_permission WHERE userID=\"%s\"", userID))
+		var msg string
+		if ok {
+			s.Sessions.Logout(userID)
+			msg = "删除成功！"
+		} else {
+			msg = "删除失败"
+		}
+		orgs := s.Query("SELECT orgID,name FROM organization;")
+		admins := s.Query("SELECT user.userID AS userID,user.account_type AS account_type, organization.name AS belonging_org FROM user,organization WHERE organization.orgID=user.belonging_org AND (account_type=1 OR account_type=2 OR account_type=3 OR account_type=4);")
+		for _, admin := range admins {
+			admin["account_type"] = server.Account_types[admin["account_type"].(int64)]
+		}
+		c.HTML(http.StatusOK, "create_new_manager.html", gin.H{
+			"msg":    msg,
+			"orgs":   orgs,
+			"admins": admins,
+		})
+	})
+
+	r.GET("/manage_admins.html", s.Midware_Auth, s.Authorities(0b011000), s.Permission(server.Perm_manage_admins), func(c *gin.Context) {
+		c.HTML(http.StatusOK, "manage_admins.html", gin.H{
+			"msg":         "",
+			"admins":      org_admins(s, c.GetInt64("belonging_org")),
+			"permissions": server.Delegable_permissions,
+		})
+	})
+
+	r.POST("/invite_admin", s.Midware_Auth, s.Authorities(0b011000), s.Permission(server.Perm_manage_admins), func(c *gin.Context) {
+		orgID := c.GetInt64("belonging_org")
+		perms := []int{}
+		for _, p := range c.PostFormArray("permission") {
+			bit, _ := strconv.Atoi(p)
+			perms = append(perms, bit)
+		}
+		msg := "添加成功！"
+		if err := invite_admin(s, c.GetString("userID"), c.GetInt64("account_type"), orgID, c.PostForm("name"), perms); err != nil {
+			msg = "添加失败：" + err.Error()
+		}
+		c.HTML(http.StatusOK, "manage_admins.html", gin.H{
+			"msg":         msg,
+			"admins":      org_admins(s, orgID),
+			"permissions": server.Delegable_permissions,
+		})
+	})
+
+	r.POST("/set_admin_permission", s.Midware_Auth, s.Authorities(0b011000), s.Permission(server.Perm_manage_admins), func(c *gin.Context) {
+		orgID := c.GetInt64("belonging_org")
+		perms := []int{}
+		for _, p := range c.PostFormArray("permission") {
+			bit, _ := strconv.Atoi(p)
+			perms = append(perms, bit)
+		}
+		msg := "修改成功！"
+		if err := set_admin_permission(s, c.GetString("userID"), c.GetInt64("account_type"), orgID, c.PostForm("userID"), perms); err != nil {
+			msg = "修改失败：" + err.Error()
+		}
+		c.HTML(http.StatusOK, "manage_admins.html", gin.H{
+			"msg":         msg,
+			"admins":      org_admins(s, orgID),
+			"permissions": server.Delegable_permissions,
+		})
+	})
+
+	r.GET("/delete_org_admin", s.Midware_Auth, s.Authorities(0b011000), s.Permission(server.Perm_manage_admins), func(c *gin.Context) {
+		orgID := c.GetInt64("belonging_org")
+		msg := "删除成功！"
+		if err := remove_org_admin(s, orgID, c.Query("userID")); err != nil {
+			msg = "删除失败：" + err.Error()
+		}
+		c.HTML(http.StatusOK, "manage_admins.html", gin.H{
+			"msg":         msg,
+			"admins":      org_admins(s, orgID),
+			"permissions": server.Delegable_permissions,
+		})
+	})
+}
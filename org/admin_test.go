@@ -0,0 +1,85 @@
+package org_test
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+
+	"Gin-ZJUST/apptest"
+	"Gin-ZJUST/server"
+)
+
+func admin_permissions(s *server.Server, userID string) int64 {
+	res := s.Query(fmt.Sprintf("SELECT permissions FROM admin_permission WHERE userID='%s';", userID))
+	if len(res) == 0 {
+		return -1
+	}
+	return res[0]["permissions"].(int64)
+}
+
+func TestDelegatedAdmins(t *testing.T) {
+	s := apptest.New_server(t, func(c *server.Config) { c.DefaultPasswd = "pw" })
+	college := apptest.Login(t, s, "collegeA")
+	perms := func(bits ...int) []string {
+		res := []string{}
+		for _, b := range bits {
+			res = append(res, fmt.Sprint(b))
+		}
+		return res
+	}
+	denied := func(c *apptest.Client, path string) {
+		t.Helper()
+		apptest.Expect_body(t, c.Get(path), "权限不足！")
+	}
+	allowed := func(c *apptest.Client, path string) {
+		t.Helper()
+		if w := c.Get(path); strings.Contains(w.Body.String(), "权限不足") || w.Code != http.StatusOK {
+			t.Fatalf("%s 应可访问：%d %s", path, w.Code, w.Body.String())
+		}
+	}
+
+	// 授予：受委派的管理员只能使用被授予的功能
+	apptest.Expect_body(t, college.Post("/invite_admin", url.Values{"name": {"helper"}, "permission": perms(server.Perm_check_student_info)}), "添加成功！")
+	helper := apptest.Login(t, s, "helper")
+	allowed(helper, "/check_student_info.html")
+	allowed(helper, "/manage_self_info.html")
+	denied(helper, "/check_branch_info.html")
+	denied(helper, "/manage_admins.html")
+	denied(helper, "/audit_basic.html")
+	apptest.Expect_body(t, helper.Post("/invite_admin", url.Values{"name": {"helper2"}}), "权限不足！")
+
+	// 授予的功能不能超出授予者自身的功能
+	apptest.Expect_body(t, college.Post("/set_admin_permission", url.Values{"userID": {"helper"}, "permission": perms(server.Perm_manage_admins, server.Perm_check_student_info, server.Perm_create_new_org)}), "修改成功！")
+	if admin_permissions(s, "helper") != server.Perm_manage_admins|server.Perm_check_student_info {
+		t.Fatalf("授予的功能超出了授予者自身的功能：%d", admin_permissions(s, "helper"))
+	}
+	allowed(helper, "/manage_admins.html")
+	apptest.Expect_body(t, helper.Post("/invite_admin", url.Values{"name": {"helper2"}, "permission": perms(server.Perm_check_branch_info, server.Perm_check_student_info)}), "添加成功！")
+	if admin_permissions(s, "helper2") != server.Perm_check_student_info {
+		t.Fatalf("受委派的管理员授予的功能超出了自身的功能：%d", admin_permissions(s, "helper2"))
+	}
+
+	// 收回：修改后立即生效
+	apptest.Expect_body(t, college.Post("/set_admin_permission", url.Values{"userID": {"helper"}, "permission": perms(server.Perm_check_branch_info)}), "修改成功！")
+	denied(helper, "/check_student_info.html")
+	denied(helper, "/manage_admins.html")
+	allowed(helper, "/check_branch_info.html")
+
+	// 不能修改、删除其他组织的管理员和本组织的默认管理员
+	apptest.Expect_body(t, apptest.Login(t, s, "collegeB").Post("/invite_admin", url.Values{"name": {"helperB"}, "permission": perms(server.Perm_add_item)}), "添加成功！")
+	apptest.Expect_body(t, college.Post("/set_admin_permission", url.Values{"userID": {"helperB"}, "permission": perms(server.Perm_manage_admins)}), "修改失败：权限不足")
+	apptest.Expect_body(t, college.Post("/set_admin_permission", url.Values{"userID": {"collegeA"}}), "修改失败：权限不足")
+	apptest.Expect_body(t, college.Get("/delete_org_admin?userID=helperB"), "删除失败：权限不足")
+	if admin_permissions(s, "helperB") != server.Perm_add_item || admin_permissions(s, "collegeA") != -1 {
+		t.Fatal("不应修改其他组织的管理员和默认管理员")
+	}
+
+	// 删除：受委派的管理员被删除后立即退出登录
+	apptest.Expect_body(t, college.Get("/delete_org_admin?userID=helper"), "删除成功！")
+	apptest.Expect_body(t, helper.Get("/home.html"), "登录已过期")
+	if len(s.Query("SELECT * FROM user WHERE userID='helper';")) != 0 || admin_permissions(s, "helper") != -1 {
+		t.Fatal("受委派的管理员应被删除")
+	}
+}
@@ -0,0 +1,723 @@
+package org
+
+import (
+	"fmt"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"Gin-ZJUST/auth"
+	"Gin-ZJUST/files"
+	"Gin-ZJUST/server"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jmoiron/sqlx"
+)
+
+func org_subtree(s *server.Server, q sqlx.Queryer, orgID int64) []int64 {
+	// 按 higher_org 广度优先遍历，返回组织自身及其全部下级组织的ID
+	res := []int64{orgID}
+	visited := map[int64]bool{orgID: true}
+	for i := 0; i < len(res); i++ {
+		sql := fmt.Sprintf("SELECT orgID FROM organization WHERE higher_org=%d;", res[i])
+		for _, child := range s.Query_with(q, sql) {
+			id := child["orgID"].(int64)
+			if !visited[id] {
+				visited[id] = true
+				res = append(res, id)
+			}
+		}
+	}
+	return res
+}
+
+func list_files(dirs []string) []string {
+	// 列出若干附件目录下的全部文件
+	res := []string{}
+	for _, dir := range dirs {
+		filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+			if err == nil && !d.IsDir() {
+				res = append(res, filepath.ToSlash(path))
+			}
+			return nil
+		})
+	}
+	return res
+}
+
+func org_delete_impact(s *server.Server, q sqlx.Queryer, orgID int64) (gin.H, bool) {
+	// 计算删除组织的影响范围：下级组织、成员、所创建的项目、相关申请以及附件目录
+	// 删除时在事务中计算（q 为 tx），预览时 q 为 s.DB
+	org := s.Query_with(q, fmt.Sprintf("SELECT * FROM organization WHERE orgID=%d;", orgID))
+	if len(org) == 0 {
+		return gin.H{}, false
+	}
+	subtree := org_subtree(s, q, orgID)
+	orgs := s.Query_with(q, fmt.Sprintf("SELECT * FROM organization WHERE orgID IN (%s) AND orgID!=%d;", server.Join_ids(subtree), orgID))
+	children := s.Query_with(q, fmt.Sprintf("SELECT * FROM organization WHERE higher_org=%d;", orgID))
+	users := s.Query_with(q, fmt.Sprintf("SELECT * FROM user WHERE belonging_org IN (%s);", server.Join_ids(subtree)))
+	items := s.Query_with(q, fmt.Sprintf("SELECT * FROM item WHERE create_org IN (%s);", server.Join_ids(subtree)))
+
+	userIDs := []string{}
+	members := 0 // 本组织直属的非管理员成员数
+	for _, user := range users {
+		userIDs = append(userIDs, user["userID"].(string))
+		if user["belonging_org"].(int64) == orgID && user["account_type"].(int64) == 5 {
+			members++
+		}
+	}
+	itemIDs := []int64{}
+	for _, item := range items {
+		itemIDs = append(itemIDs, item["itemID"].(int64))
+	}
+	appliances := s.Query_with(q, fmt.Sprintf("SELECT * FROM appliance WHERE userID IN (%s) OR itemID IN (%s);", server.Join_strs(userIDs), server.Join_ids(itemIDs)))
+
+	dirs := []string{}
+	for _, userID := range userIDs {
+		dirs = append(dirs, s.Upload_root+"basic/"+userID+"/")
+	}
+	for _, id := range subtree {
+		dirs = append(dirs, s.Upload_root+"activity/"+strconv.FormatInt(id, 10)+"/")
+	}
+	applianceIDs := []int64{}
+	for _, appliance := range appliances {
+		applianceIDs = append(applianceIDs, appliance["applianceID"].(int64))
+	}
+
+	return gin.H{
+		"org":          org[0],
+		"children":     children,
+		"orgs":         orgs,
+		"users":        users,
+		"members":      members,
+		"items":        items,
+		"appliances":   appliances,
+		"dirs":         dirs,
+		"files":        list_files(dirs),
+		"applianceIDs": applianceIDs,
+		"itemIDs":      itemIDs,
+	}, true
+}
+
+func delete_org_cascade(s *server.Server, tx *sqlx.Tx, impact gin.H) ([]files.Removed, error) {
+	// 级联删除：组织自身及全部下级组织、其成员、所创建的项目以及相关申请
+	orgID := impact["org"].(map[string]any)["orgID"].(int64)
+	orgIDs := []int64{orgID}
+	for _, org := range impact["orgs"].([]map[string]any) {
+		orgIDs = append(orgIDs, org["orgID"].(int64))
+	}
+	userIDs := []string{}
+	for _, user := range impact["users"].([]map[string]any) {
+		userIDs = append(userIDs, user["userID"].(string))
+	}
+	itemIDs := []int64{}
+	for _, item := range impact["items"].([]map[string]any) {
+		itemIDs = append(itemIDs, item["itemID"].(int64))
+	}
+	// 附件记录与申请、项目在同一事务中删除，附件存储中的文件在提交后删除
+	removed := []files.Removed{}
+	for owner_type, ids := range map[string][]int64{files.Owner_appliance: impact["applianceIDs"].([]int64), files.Owner_item: itemIDs} {
+		r, err := files.Remove_with(s, tx, owner_type, ids)
+		if err != nil {
+			return nil, err
+		}
+		removed = append(removed, r)
+	}
+	sqls := []string{
+		fmt.Sprintf("DELETE FROM appliance WHERE userID IN (%s) OR itemID IN (%s);", server.Join_strs(userIDs), server.Join_ids(itemIDs)),
+		fmt.Sprintf("DELETE FROM item WHERE itemID IN (%s);", server.Join_ids(itemIDs)),
+		fmt.Sprintf("DELETE FROM item_closed WHERE itemID IN (%s);", server.Join_ids(itemIDs)),
+		fmt.Sprintf("DELETE FROM user WHERE userID IN (%s);", server.Join_strs(userIDs)),
+		fmt.Sprintf("DELETE FROM admin_permission WHERE userID IN (%s);", server.Join_strs(userIDs)),
+		fmt.Sprintf("DELETE FROM organization WHERE orgID IN (%s);", server.Join_ids(orgIDs)),
+	}
+	for _, sql := range sqls {
+		if _, err := tx.Exec(sql); err != nil {
+			return nil, err
+		}
+	}
+	return removed, nil
+}
+
+func delete_org_reassign(tx *sqlx.Tx, impact gin.H, target map[string]any) error {
+	// 转移后删除：直属下级组织、直属学生及所创建的项目转移到目标组织，再删除组织本身及其管理员账号
+	org := impact["org"].(map[string]any)
+	orgID := org["orgID"].(int64)
+	targetID := target["orgID"].(int64)
+	if targetID == orgID {
+		return fmt.Errorf("目标组织不能是待删除的组织")
+	}
+	for _, sub := range impact["orgs"].([]map[string]any) {
+		if sub["orgID"].(int64) == targetID {
+			return fmt.Errorf("目标组织不能是待删除组织的下级组织")
+		}
+	}
+	target_type := target["type"].(int64)
+	for _, child := range impact["children"].([]map[string]any) {
+		if org_parent_type[child["type"].(int64)] != target_type {
+			return fmt.Errorf("目标组织无法接收下级组织「%s」", child["name"])
+		}
+	}
+	if impact["members"].(int) > 0 && target_type != 3 {
+		return fmt.Errorf("仅团支部可接收学生成员")
+	}
+
+	sqls := []string{
+		fmt.Sprintf("UPDATE organization SET higher_org=%d WHERE higher_org=%d;", targetID, orgID),
+		fmt.Sprintf("UPDATE user SET belonging_org=%d WHERE belonging_org=%d AND account_type=5;", targetID, orgID),
+		fmt.Sprintf("UPDATE item SET create_org=%d WHERE create_org=%d;", targetID, orgID),
+		fmt.Sprintf("DELETE FROM admin_permission WHERE userID IN (SELECT userID FROM user WHERE belonging_org=%d);", orgID),
+		fmt.Sprintf("DELETE FROM user WHERE belonging_org=%d;", orgID),
+		fmt.Sprintf("DELETE FROM organization WHERE orgID=%d;", orgID),
+	}
+	for _, sql := range sqls {
+		if _, err := tx.Exec(sql); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func delete_org(s *server.Server, orgID int64, mode string, targetID int64) error {
+	// 在同一事务中按指定方式删除组织
+	// mode: block（存在下级组织、成员或项目时拒绝删除）、reassign（转移给目标组织）、cascade（级联删除）
+	tx, err := s.DB.Beginx()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	// 影响范围在事务中计算，避免预览后、删除前新增的成员或项目被遗漏
+	impact, ok := org_delete_impact(s, tx, orgID)
+	if !ok {
+		return fmt.Errorf("组织不存在")
+	}
+	var target []map[string]any
+	var removed []files.Removed
+	if mode == "reassign" {
+		target = s.Query_with(tx, fmt.Sprintf("SELECT * FROM organization WHERE orgID=%d;", targetID))
+		if len(target) == 0 {
+			return fmt.Errorf("目标组织不存在")
+		}
+	}
+
+	switch mode {
+	case "block":
+		if len(impact["children"].([]map[string]any)) > 0 || impact["members"].(int) > 0 || len(impact["items"].([]map[string]any)) > 0 {
+			return fmt.Errorf("该组织仍有下级组织、成员或项目")
+		}
+		if _, err = tx.Exec(fmt.Sprintf("DELETE FROM admin_permission WHERE userID IN (SELECT userID FROM user WHERE belonging_org=%d);", orgID)); err == nil {
+			_, err = tx.Exec(fmt.Sprintf("DELETE FROM user WHERE belonging_org=%d;", orgID))
+		}
+		if err == nil {
+			_, err = tx.Exec(fmt.Sprintf("DELETE FROM organization WHERE orgID=%d;", orgID))
+		}
+	case "reassign":
+		err = delete_org_reassign(tx, impact, target[0])
+	case "cascade":
+		removed, err = delete_org_cascade(s, tx, impact)
+	default:
+		err = fmt.Errorf("未知的删除方式")
+	}
+	if err != nil {
+		return err
+	}
+	if err = tx.Commit(); err != nil {
+		return err
+	}
+
+	// 事务提交后再处理硬盘中存放的附件
+	activity_dir := s.Upload_root + "activity/" + strconv.FormatInt(orgID, 10) + "/"
+	// 组织已删除，附件处理失败只记录日志
+	remove := func(dir string) {
+		if err := os.RemoveAll(dir); err != nil {
+			s.Log.Error("删除附件目录失败", "orgID", orgID, "error", err)
+		}
+	}
+	if mode == "cascade" {
+		for _, dir := range impact["dirs"].([]string) {
+			remove(dir)
+		}
+		for _, r := range removed {
+			r.Release(s)
+		}
+	} else if mode == "reassign" {
+		// 附件路径由创建组织决定，随项目一并转移
+		target_dir := s.Upload_root + "activity/" + strconv.FormatInt(targetID, 10) + "/"
+		dir, _ := os.ReadDir(activity_dir)
+		if len(dir) > 0 {
+			if err = os.MkdirAll(target_dir, os.ModePerm); err != nil {
+				s.Log.Error("创建附件目录失败", "orgID", targetID, "error", err)
+			}
+		}
+		for _, d := range dir {
+			if err = os.Rename(activity_dir+d.Name(), target_dir+d.Name()); err != nil {
+				s.Log.Error("转移附件失败", "orgID", orgID, "target", targetID, "error", err)
+			}
+		}
+		remove(activity_dir)
+	} else {
+		remove(activity_dir)
+	}
+	return nil
+}
+
+func delete_student(s *server.Server, userID string) error {
+	// 在同一事务中删除学生账号及其申请和附件记录，提交后再删除附件存储中的文件和早期附件目录
+	tx, err := s.DB.Beginx()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	applianceIDs := []int64{}
+	for _, appliance := range s.Query_with(tx, fmt.Sprintf("SELECT applianceID FROM appliance WHERE userID=%s;", server.Join_strs([]string{userID}))) {
+		applianceIDs = append(applianceIDs, appliance["applianceID"].(int64))
+	}
+	removed, err := files.Remove_with(s, tx, files.Owner_appliance, applianceIDs)
+	if err != nil {
+		return err
+	}
+	sqls := []string{
+		fmt.Sprintf("DELETE FROM appliance WHERE applianceID IN (%s);", server.Join_ids(applianceIDs)),
+		fmt.Sprintf("DELETE FROM admin_permission WHERE userID=%s;", server.Join_strs([]string{userID})),
+		fmt.Sprintf("DELETE FROM user WHERE userID=%s;", server.Join_strs([]string{userID})),
+	}
+	for _, sql := range sqls {
+		if _, err = tx.Exec(sql); err != nil {
+			return err
+		}
+	}
+	if err = tx.Commit(); err != nil {
+		return err
+	}
+	s.Sessions.Logout(userID)
+	removed.Release(s)
+	if err = os.RemoveAll(s.Upload_root + "basic/" + userID + "/"); err != nil {
+		s.Log.Error("删除附件目录失败", "userID", userID, "error", err)
+	}
+	return nil
+}
+
+var org_parent_type = map[int64]int64{ // 组织类型 to 允许的上级组织类型
+	0: -1, // 学校从属于系统根组织
+	1: 0,  // 单位从属于学校
+	2: 0,  // 学院从属于学校
+	3: 2,  // 团支部从属于学院
+}
+
+func org_tree(s *server.Server, type_names map[int64]string) []map[string]any {
+	// 根据 organization.higher_org 构建组织树，并统计每个节点（含下级组织）的学生数与待审核申请数
+	orgs := s.Query("SELECT * FROM organization ORDER BY orgID;")
+	members := map[int64]int64{}
+	for _, row := range s.Query("SELECT belonging_org, COUNT(*) AS n FROM user WHERE account_type=5 GROUP BY belonging_org;") {
+		members[row["belonging_org"].(int64)] = row["n"].(int64)
+	}
+	pending := map[int64]int64{}
+	for _, row := range s.Query("SELECT user.belonging_org AS orgID, COUNT(*) AS n FROM appliance,user WHERE appliance.userID=user.userID AND appliance.status IN (0,1,3) GROUP BY user.belonging_org;") {
+		pending[row["orgID"].(int64)] = row["n"].(int64)
+	}
+
+	nodes := map[int64]map[string]any{}
+	for _, org := range orgs {
+		org["type_name"] = type_names[org["type"].(int64)]
+		org["children"] = []map[string]any{}
+		nodes[org["orgID"].(int64)] = org
+	}
+	roots := []map[string]any{}
+	for _, org := range orgs {
+		var parent map[string]any
+		ok := false
+		if higher, is_int := org["higher_org"].(int64); is_int {
+			parent, ok = nodes[higher]
+		}
+		if ok {
+			parent["children"] = append(parent["children"].([]map[string]any), org)
+		} else {
+			roots = append(roots, org)
+		}
+	}
+
+	var count func(node map[string]any) (int64, int64)
+	count = func(node map[string]any) (int64, int64) {
+		orgID := node["orgID"].(int64)
+		m, p := members[orgID], pending[orgID]
+		for _, child := range node["children"].([]map[string]any) {
+			cm, cp := count(child)
+			m += cm
+			p += cp
+		}
+		node["members"] = m
+		node["pending"] = p
+		return m, p
+	}
+	for _, root := range roots {
+		count(root)
+	}
+	return roots
+}
+
+func check_org_parent(s *server.Server, orgID int64, org_type int64, parentID int64) error {
+	// 校验组织挂靠到上级组织是否合法：上级组织存在、层级关系正确且不形成环
+	parent := s.Query(fmt.Sprintf("SELECT * FROM organization WHERE orgID=%d;", parentID))
+	if len(parent) == 0 {
+		return fmt.Errorf("上级组织不存在")
+	}
+	for _, id := range org_subtree(s, s.DB, orgID) {
+		if id == parentID {
+			return fmt.Errorf("上级组织不能是该组织本身或其下级组织")
+		}
+	}
+	if need, ok := org_parent_type[org_type]; !ok || need != parent[0]["type"].(int64) {
+		return fmt.Errorf("组织层级不合法")
+	}
+	return nil
+}
+
+func rename_org(s *server.Server, orgID int64, name string) error {
+	// 重命名组织，名称不可为空且不可重复
+	if name == "" {
+		return fmt.Errorf("名称不能为空")
+	}
+	org := s.Query(fmt.Sprintf("SELECT * FROM organization WHERE orgID=%d;", orgID))
+	if len(org) == 0 {
+		return fmt.Errorf("组织不存在")
+	}
+	// 与其他组织重名时拒绝，名称不变时直接成功
+	if len(s.Query(fmt.Sprintf("SELECT * FROM organization WHERE name=%s AND orgID<>%d;", server.Join_strs([]string{name}), orgID))) > 0 {
+		return fmt.Errorf("名称重复")
+	}
+	// 管理员账号通过 belonging_org 关联组织，重命名不影响其访问
+	_, err := s.DB.Exec("UPDATE organization SET name=? WHERE orgID=?;", name, orgID)
+	return err
+}
+
+func move_org(s *server.Server, orgID int64, parentID int64) error {
+	// 将组织挂靠到新的上级组织
+	org := s.Query(fmt.Sprintf("SELECT * FROM organization WHERE orgID=%d;", orgID))
+	if len(org) == 0 {
+		return fmt.Errorf("组织不存在")
+	}
+	if err := check_org_parent(s, orgID, org[0]["type"].(int64), parentID); err != nil {
+		return err
+	}
+	_, err := s.DB.Exec(fmt.Sprintf("UPDATE organization SET higher_org=%d WHERE orgID=%d;", parentID, orgID))
+	return err
+}
+
+func merge_org(s *server.Server, sourceID int64, targetID int64) error {
+	// 将组织合并到同类型的目标组织：下级组织、学生和项目转移后删除原组织
+	source := s.Query(fmt.Sprintf("SELECT * FROM organization WHERE orgID=%d;", sourceID))
+	target := s.Query(fmt.Sprintf("SELECT * FROM organization WHERE orgID=%d;", targetID))
+	if len(source) == 0 || len(target) == 0 {
+		return fmt.Errorf("组织不存在")
+	}
+	if source[0]["type"].(int64) != target[0]["type"].(int64) {
+		return fmt.Errorf("只能合并同类型的组织")
+	}
+	return delete_org(s, sourceID, "reassign", targetID)
+}
+
+// 组织的创建、删除与调整，团支部管理，以及管辖范围内的学生管理
+func Register(s *server.Server) {
+	r := s.Router
+
+	r.GET("/create_new_org.html", s.Midware_Auth, s.Authorities(0b000011), func(c *gin.Context) {
+		orgs := s.Query("SELECT a.orgID AS orgID,a.name AS name,a.type AS type, b.name AS higher_org FROM organization AS a LEFT JOIN organization AS b WHERE a.higher_org=b.orgID;")
+		for _, org := range orgs {
+			org["type"] = server.Org_type[org["type"].(int64)]
+		}
+		c.HTML(http.StatusOK, "create_new_org.html", gin.H{
+			"msg":  "",
+			"orgs": orgs,
+		})
+	})
+
+	r.POST("/create_new_organization", s.Midware_Auth, s.Authorities(0b000011), s.Handle(func(c *gin.Context) error {
+		org_name := c.PostForm("name")
+		orgtp, err := strconv.ParseInt(c.PostForm("type"), 10, 64)
+		if err != nil {
+			return server.Err_bad_request
+		}
+		higher_org, err := strconv.ParseInt(c.PostForm("belonging_org"), 10, 64)
+		if err != nil {
+			return server.Err_bad_request
+		}
+		sql := fmt.Sprintf("SELECT * FROM organization WHERE name=\"%s\";", org_name)
+		query_res := s.Query(sql)
+		msg := ""
+		if len(query_res) > 0 {
+			msg = "添加失败：名称重复！"
+		} else if err := check_org_parent(s, 0, orgtp, higher_org); err != nil {
+			// 与移动组织相同，校验组织类型及上级组织的层级关系；新组织尚无ID，以0代替
+			msg = "添加失败：" + err.Error()
+		} else {
+			sql = fmt.Sprintf("INSERT INTO organization VALUES(NULL,\"%s\",%d,%d);", org_name, orgtp, higher_org)
+			ok := s.Exec(sql)
+			if ok {
+				sql = fmt.Sprintf("SELECT orgID FROM organization WHERE name=\"%s\";", org_name)
+				org, err := s.Query_one(sql)
+				if err != nil {
+					return server.Internal(err)
+				}
+				orgID := org["orgID"].(int64)
+				sql = fmt.Sprintf("INSERT INTO user VALUES(\"%s\",\"%s\",%d,%d);", org_name, s.Config.DefaultPasswd, orgtp+1, orgID)
+				if !s.Exec(sql) {
+					sql = fmt.Sprintf("DELETE FROM organization WHERE orgID=%d", orgID)
+					s.Exec(sql)
+					ok = false
+				}
+			}
+
+			if ok {
+				msg = "添加成功！"
+			} else {
+				msg = "添加失败"
+			}
+		}
+		orgs := s.Query("SELECT a.orgID AS orgID,a.name AS name,a.type AS type, b.name AS higher_org FROM organization AS a LEFT JOIN organization AS b WHERE a.higher_org=b.orgID;")
+		for _, org := range orgs {
+			org["type"] = server.Org_type[org["type"].(int64)]
+		}
+		c.HTML(http.StatusOK, "create_new_org.html", gin.H{
+			"msg":  msg,
+			"orgs": orgs,
+		})
+		return nil
+	}))
+
+	r.GET("/delete_org", s.Midware_Auth, s.Authorities(0b000011), s.Handle(func(c *gin.Context) error {
+		// 删除前预览影响范围，确认删除方式后再提交
+		orgID, _ := strconv.ParseInt(c.Query("orgID"), 10, 64)
+		impact, ok := org_delete_impact(s, s.DB, orgID)
+		if !ok {
+			return server.Err_not_found
+		}
+		// 预览时一并列出将被删除的附件
+		attachments := append(files.Of(s, files.Owner_appliance, impact["applianceIDs"].([]int64)), files.Of(s, files.Owner_item, impact["itemIDs"].([]int64))...)
+		for _, a := range attachments {
+			impact["files"] = append(impact["files"].([]string), a["name"].(string)+"（附件ID："+a["attachmentID"].(string)+"）")
+		}
+		for _, org := range impact["orgs"].([]map[string]any) {
+			org["type"] = server.Org_type[org["type"].(int64)]
+		}
+		for _, user := range impact["users"].([]map[string]any) {
+			user["account_type"] = server.Account_types[user["account_type"].(int64)]
+		}
+		impact["msg"] = ""
+		impact["targets"] = s.Query(fmt.Sprintf("SELECT orgID,name FROM organization WHERE orgID NOT IN (%s);", server.Join_ids(org_subtree(s, s.DB, orgID))))
+		c.HTML(http.StatusOK, "delete_org.html", impact)
+		return nil
+	}))
+
+	r.POST("/delete_org", s.Midware_Auth, s.Authorities(0b000011), func(c *gin.Context) {
+		orgID, _ := strconv.ParseInt(c.PostForm("orgID"), 10, 64)
+		targetID, _ := strconv.ParseInt(c.PostForm("target"), 10, 64)
+		err := delete_org(s, orgID, c.PostForm("mode"), targetID)
+		msg := ""
+		if err == nil {
+			msg = "删除成功！"
+		} else {
+			msg = "删除失败：" + err.Error()
+		}
+		orgs := s.Query("SELECT a.orgID AS orgID,a.name AS name,a.type AS type, b.name AS higher_org FROM organization AS a LEFT JOIN organization AS b WHERE a.higher_org=b.orgID;")
+		for _, org := range orgs {
+			org["type"] = server.Org_type[org["type"].(int64)]
+		}
+		c.HTML(http.StatusOK, "create_new_org.html", gin.H{
+			"msg":  msg,
+			"orgs": orgs,
+		})
+	})
+
+	render_org_tree := func(c *gin.Context, msg string) {
+		c.HTML(http.StatusOK, "org_tree.html", gin.H{
+			"msg":  msg,
+			"tree": org_tree(s, server.Org_type),
+			"orgs": s.Query("SELECT orgID,name FROM organization;"),
+		})
+	}
+
+	r.GET("/org_tree.html", s.Midware_Auth, s.Authorities(0b000011), func(c *gin.Context) {
+		render_org_tree(c, "")
+	})
+
+	r.POST("/rename_org", s.Midware_Auth, s.Authorities(0b000011), func(c *gin.Context) {
+		orgID, _ := strconv.ParseInt(c.PostForm("orgID"), 10, 64)
+		msg := "重命名成功！"
+		if err := rename_org(s, orgID, c.PostForm("name")); err != nil {
+			msg = "重命名失败：" + err.Error()
+		}
+		render_org_tree(c, msg)
+	})
+
+	r.POST("/move_org", s.Midware_Auth, s.Authorities(0b000011), func(c *gin.Context) {
+		orgID, _ := strconv.ParseInt(c.PostForm("orgID"), 10, 64)
+		parentID, _ := strconv.ParseInt(c.PostForm("higher_org"), 10, 64)
+		msg := "移动成功！"
+		if err := move_org(s, orgID, parentID); err != nil {
+			msg = "移动失败：" + err.Error()
+		}
+		render_org_tree(c, msg)
+	})
+
+	r.POST("/merge_org", s.Midware_Auth, s.Authorities(0b000011), func(c *gin.Context) {
+		sourceID, _ := strconv.ParseInt(c.PostForm("orgID"), 10, 64)
+		targetID, _ := strconv.ParseInt(c.PostForm("target"), 10, 64)
+		msg := "合并成功！"
+		if err := merge_org(s, sourceID, targetID); err != nil {
+			msg = "合并失败：" + err.Error()
+		}
+		render_org_tree(c, msg)
+	})
+
+	r.GET("/check_branch_info.html", s.Midware_Auth, s.Authorities(0b001000), s.Permission(server.Perm_check_branch_info), func(c *gin.Context) {
+		orgID := c.GetInt64("belonging_org")
+		sql := fmt.Sprintf("SELECT * FROM organization WHERE higher_org=%d", orgID)
+		branches := s.Query(sql)
+		c.HTML(http.StatusOK, "check_branch_info.html", gin.H{
+			"msg":      "",
+			"college":  s.Org_name(orgID),
+			"branches": branches,
+		})
+	})
+
+	r.POST("/create_new_branch", s.Midware_Auth, s.Authorities(0b001000), s.Permission(server.Perm_check_branch_info), func(c *gin.Context) {
+		orgID := c.GetInt64("belonging_org")
+		userID := c.PostForm("name")
+		sql := fmt.Sprintf("SELECT * FROM organization WHERE name=\"%s\";", userID)
+		query_res := s.Query(sql)
+		msg := ""
+		if len(query_res) > 0 {
+			msg = "添加失败：名称重复！"
+		} else {
+			res, err := s.DB.Exec(fmt.Sprintf("INSERT INTO organization VALUES(NULL,\"%s\",3,%d);", userID, orgID))
+			ok := err == nil
+			if ok {
+				branchID, _ := res.LastInsertId()
+				sql = fmt.Sprintf("INSERT INTO user VALUES(\"%s\",\"%s\",4,%d);", userID, s.Config.DefaultPasswd, branchID)
+				ok = s.Exec(sql)
+			}
+			if ok {
+				msg = "添加成功！"
+			} else {
+				msg = "添加失败"
+			}
+		}
+		sql = fmt.Sprintf("SELECT * FROM organization WHERE higher_org=%d", orgID)
+		branches := s.Query(sql)
+		c.HTML(http.StatusOK, "check_branch_info.html", gin.H{
+			"msg":      msg,
+			"college":  s.Org_name(orgID),
+			"branches": branches,
+		})
+	})
+
+	r.GET("/delete_branch", s.Midware_Auth, s.Authorities(0b001000), s.Permission(server.Perm_check_branch_info), func(c *gin.Context) {
+		orgID := c.GetInt64("belonging_org")
+		to_delete, _ := strconv.ParseInt(c.Query("branchID"), 10, 64)
+		msg := ""
+		sql := fmt.Sprintf("SELECT * FROM organization WHERE orgID=%d AND higher_org=%d;", to_delete, orgID)
+		if len(s.Query(sql)) == 0 {
+			msg = "删除失败：权限不足。"
+		} else {
+			// 与学校管理员级联删除组织相同，一并删除团支部的成员、申请和附件
+			if err := delete_org(s, to_delete, "cascade", 0); err != nil {
+				msg = "删除失败"
+			} else {
+				msg = "删除成功！"
+			}
+		}
+		sql = fmt.Sprintf("SELECT * FROM organization WHERE higher_org=%d", orgID)
+		branches := s.Query(sql)
+		c.HTML(http.StatusOK, "check_branch_info.html", gin.H{
+			"msg":      msg,
+			"college":  s.Org_name(orgID),
+			"branches": branches,
+		})
+	})
+
+	r.GET("/check_student_info.html", s.Midware_Auth, s.Authorities(0b011011), s.Permission(server.Perm_check_student_info), func(c *gin.Context) {
+		//根据不同类型的组织查询管辖范围内的学生
+		account_type := c.GetInt64("account_type")
+		stus := s.Students_in_scope(account_type, c.GetInt64("belonging_org"))
+
+		c.HTML(http.StatusOK, "check_student_info.html", gin.H{
+			"msg":  "",
+			"stus": stus,
+		})
+	})
+
+	r.GET("/delete_stu", s.Midware_Auth, s.Authorities(0b011011), s.Permission(server.Perm_check_student_info), func(c *gin.Context) {
+		to_delete := c.Query("name")
+		account_type := c.GetInt64("account_type")
+		admin_org := c.GetInt64("belonging_org")
+		msg := ""
+		if !s.Student_in_scope(account_type, admin_org, to_delete) {
+			// 只能删除管辖范围内的学生：学校管理员、超级管理员可删除所有学生，学院、团支部管理员只能删除下属学生
+			msg = "删除失败：权限不足。"
+		} else {
+			if err := delete_student(s, to_delete); err != nil {
+				msg = "删除失败"
+			} else {
+				msg = "删除成功！"
+			}
+		}
+
+		stus := s.Students_in_scope(account_type, admin_org)
+
+		c.HTML(http.StatusOK, "check_student_info.html", gin.H{
+			"msg":  msg,
+			"stus": stus,
+		})
+	})
+
+	r.GET("/admin_reset_passwd", s.Midware_Auth, s.Authorities(0b011011), s.Permission(server.Perm_check_student_info), func(c *gin.Context) {
+		to_reset := c.Query("name")
+		account_type := c.GetInt64("account_type")
+		admin_org := c.GetInt64("belonging_org")
+		msg := ""
+		if !s.Student_in_scope(account_type, admin_org, to_reset) {
+			msg = "重置失败：权限不足。"
+		} else if res, err := auth.Admin_reset_passwd(s, to_reset); err != nil {
+			msg = "重置失败：" + err.Error()
+		} else {
+			msg = res
+		}
+		c.HTML(http.StatusOK, "check_student_info.html", gin.H{
+			"msg":  msg,
+			"stus": s.Students_in_scope(account_type, admin_org),
+		})
+	})
+
+	r.GET("/import_new_student.html", s.Midware_Auth, s.Authorities(0b010000), s.Permission(server.Perm_import_new_student), func(c *gin.Context) {
+		c.HTML(http.StatusOK, "import_new_student.html", gin.H{
+			"msg":         "",
+			"branch_name": s.Org_name(c.GetInt64("belonging_org")),
+		})
+	})
+
+	r.POST("/import_student", s.Midware_Auth, s.Authorities(0b010000), s.Permission(server.Perm_import_new_student), func(c *gin.Context) {
+		orgID := c.GetInt64("belonging_org")
+		student_name := c.PostForm("name")
+		sql := fmt.Sprintf("SELECT * FROM user WHERE userID=\"%s\";", student_name)
+		msg := ""
+		if len(s.Query(sql)) > 0 {
+			msg = "添加失败：重复名称！"
+		} else {
+			sql = fmt.Sprintf("INSERT INTO user VALUES(\"%s\",\"%s\",5,%d);", student_name, s.Config.DefaultPasswd, orgID)
+			ok := s.Exec(sql)
+			if ok {
+				msg = "添加成功！"
+			} else {
+				msg = "添加失败"
+			}
+		}
+		c.HTML(http.StatusOK, "import_new_student.html", gin.H{
+			"msg":         msg,
+			"branch_name": s.Org_name(orgID),
+		})
+	})
+
+	register_admin(s)
+}
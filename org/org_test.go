@@ -0,0 +1,212 @@
+package org_test
+
+import (
+	"fmt"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+
+	"Gin-ZJUST/apptest"
+	"Gin-ZJUST/server"
+)
+
+func TestDeletionsByAccountType(t *testing.T) {
+	t.Run("student", func(t *testing.T) {
+		s := apptest.New_server(t)
+		idA := apptest.Apply(t, s, apptest.Login(t, s, "stuA"), "a")
+		idB := apptest.Apply(t, s, apptest.Login(t, s, "stuB"), "b")
+		stu := apptest.Login(t, s, "stuA")
+		apptest.Expect_body(t, stu.Get(fmt.Sprintf("/delete_appliance?applianceID=%d", idB)), "非本人项目！")
+		apptest.Expect_body(t, stu.Get(fmt.Sprintf("/delete_appliance?applianceID=%d", idA)), "删除成功！")
+		if apptest.Status_of(s, "appliance", idA) != -1 || apptest.Status_of(s, "appliance", idB) == -1 {
+			t.Fatal("学生只能撤回本人的申请")
+		}
+		apptest.Expect_body(t, stu.Get("/delete_stu?name=stuB"), "权限不足！")
+	})
+
+	t.Run("branch", func(t *testing.T) {
+		s := apptest.New_server(t)
+		apptest.Apply(t, s, apptest.Login(t, s, "stuA"), "a")
+		branch := apptest.Login(t, s, "branchA")
+		apptest.Expect_body(t, branch.Get("/delete_stu?name=stuB"), "删除失败：权限不足。")
+		apptest.Expect_body(t, branch.Get("/delete_stu?name=stuA"), "删除成功！")
+		// 删除学生时一并删除其申请、附件记录和硬盘中的附件
+		if len(s.Query("SELECT * FROM appliance WHERE userID='stuA';")) != 0 || len(s.Query("SELECT * FROM attachment;")) != 0 {
+			t.Fatal("删除学生后仍有其申请或附件记录")
+		}
+		if _, err := os.Stat(s.Upload_root + "files/" + apptest.Content_key("a")[:2] + "/" + apptest.Content_key("a")); !os.IsNotExist(err) {
+			t.Fatal("删除学生后应删除硬盘中的附件")
+		}
+		apptest.Expect_body(t, branch.Get("/delete_branch?branchID=4"), "权限不足！")
+	})
+
+	t.Run("college", func(t *testing.T) {
+		s := apptest.New_server(t)
+		apptest.Apply(t, s, apptest.Login(t, s, "stuA"), "a")
+		s.Exec("INSERT INTO user VALUES('branchA2','pw',4,4);")
+		s.Exec("INSERT INTO admin_permission VALUES('branchA2',0);")
+		college := apptest.Login(t, s, "collegeA")
+		apptest.Expect_body(t, college.Get("/delete_branch?branchID=6"), "删除失败：权限不足。")
+		apptest.Expect_body(t, college.Get("/delete_branch?branchID=4"), "删除成功！")
+		// 删除团支部时与级联删除组织相同，一并删除其成员、受委派的管理员、申请和附件
+		for _, sql := range []string{
+			"SELECT * FROM organization WHERE orgID=4;",
+			"SELECT * FROM user WHERE userID IN ('branchA','branchA2','stuA');",
+			"SELECT * FROM admin_permission;",
+			"SELECT * FROM appliance;",
+			"SELECT * FROM attachment;",
+		} {
+			if len(s.Query(sql)) != 0 {
+				t.Fatalf("删除团支部后仍有记录：%s", sql)
+			}
+		}
+		if _, err := os.Stat(s.Upload_root + "files/" + apptest.Content_key("a")[:2] + "/" + apptest.Content_key("a")); !os.IsNotExist(err) {
+			t.Fatal("删除团支部后应删除硬盘中的附件")
+		}
+		apptest.Expect_body(t, college.Get("/delete_stu?name=stuB"), "删除失败：权限不足。")
+	})
+
+	t.Run("unit", func(t *testing.T) {
+		s := apptest.New_server(t)
+		unit := apptest.Login(t, s, "unit")
+		apptest.Expect_body(t, unit.Get("/delete_stu?name=stuA"), "权限不足！")
+		apptest.Expect_body(t, unit.Get("/delete_basic_item?name="+url.QueryEscape("志愿服务")), "权限不足！")
+		apptest.Expect_body(t, unit.Post("/delete_org", url.Values{"orgID": {"6"}, "mode": {"cascade"}}), "权限不足！")
+	})
+
+	t.Run("school", func(t *testing.T) {
+		s := apptest.New_server(t)
+		apptest.Apply(t, s, apptest.Login(t, s, "stuB"), "b")
+		school := apptest.Login(t, s, "school")
+		apptest.Expect_body(t, school.Get("/delete_admin?userID=unit"), "权限不足！")
+		apptest.Expect_body(t, school.Post("/delete_org", url.Values{"orgID": {"5"}, "mode": {"block"}}), "删除失败")
+		apptest.Expect_body(t, school.Get("/delete_org?orgID=5"), "stuB")
+		apptest.Expect_body(t, school.Post("/delete_org", url.Values{"orgID": {"5"}, "mode": {"cascade"}}), "删除成功！")
+		for _, sql := range []string{
+			"SELECT * FROM organization WHERE orgID IN (5,6);",
+			"SELECT * FROM user WHERE userID IN ('collegeB','branchB','stuB');",
+			"SELECT * FROM appliance WHERE userID='stuB';",
+		} {
+			if len(s.Query(sql)) != 0 {
+				t.Fatalf("级联删除后仍有记录：%s", sql)
+			}
+		}
+		if len(s.Query("SELECT * FROM attachment;")) != 0 {
+			t.Fatal("级联删除后应删除学生的附件")
+		}
+		if _, err := os.Stat(s.Upload_root + "files/" + apptest.Content_key("b")[:2] + "/" + apptest.Content_key("b")); !os.IsNotExist(err) {
+			t.Fatal("级联删除后应删除硬盘中的附件")
+		}
+		apptest.Expect_body(t, school.Get("/delete_stu?name=stuA"), "删除成功！")
+	})
+
+	t.Run("root", func(t *testing.T) {
+		s := apptest.New_server(t)
+		unit := apptest.Login(t, s, "unit")
+		root := apptest.Login(t, s, "root")
+		apptest.Expect_body(t, root.Get("/delete_admin?userID=unit"), "删除成功！")
+		apptest.Expect_body(t, unit.Get("/home.html"), "登录已过期")
+		apptest.Expect_body(t, root.Get("/delete_basic_item?name="+url.QueryEscape("志愿服务")), "删除成功！")
+		if apptest.Status_of(s, "item", 1) != -1 {
+			t.Fatal("基础项目应被删除")
+		}
+		apptest.Expect_body(t, root.Post("/delete_org", url.Values{"orgID": {"6"}, "mode": {"reassign"}, "target": {"4"}}), "删除成功！")
+		if org := s.Query("SELECT belonging_org FROM user WHERE userID='stuB';"); org[0]["belonging_org"].(int64) != 4 {
+			t.Fatal("转移后删除时学生应转移到目标团支部")
+		}
+	})
+}
+
+func higher_org(s *server.Server, orgID int64) any {
+	res := s.Query(fmt.Sprintf("SELECT higher_org FROM organization WHERE orgID=%d;", orgID))
+	if len(res) == 0 {
+		return nil
+	}
+	return res[0]["higher_org"]
+}
+
+func TestOrgTreeMoveMerge(t *testing.T) {
+	s := apptest.New_server(t)
+	apptest.Apply(t, s, apptest.Login(t, s, "stuA"), "证明")
+	root := apptest.Login(t, s, "root")
+
+	// 组织树：每个节点统计本组织及下级组织的学生数和待审核申请数
+	w := root.Get("/org_tree.html")
+	for _, want := range []string{
+		"学校（学校）学生：2 待审核申请：1",
+		"学院A（学院）学生：1 待审核申请：1",
+		"团支部A（团支部）学生：1 待审核申请：1",
+		"学院B（学院）学生：1 待审核申请：0",
+		"单位（单位）学生：0 待审核申请：0",
+	} {
+		apptest.Expect_body(t, w, want)
+	}
+	body := w.Body.String()
+	if i, j := strings.Index(body, "学院B（学院）"), strings.Index(body, "团支部B（团支部）"); i < 0 || j < i {
+		t.Fatal("团支部B应显示在学院B之下")
+	}
+
+	// 重命名：名称不变时成功，与其他组织重名时失败
+	apptest.Expect_body(t, root.Post("/rename_org", url.Values{"orgID": {"3"}, "name": {"学院A"}}), "重命名成功！")
+	apptest.Expect_body(t, root.Post("/rename_org", url.Values{"orgID": {"3"}, "name": {"学院B"}}), "重命名失败：名称重复")
+	apptest.Expect_body(t, root.Post("/rename_org", url.Values{"orgID": {"3"}, "name": {"学院C"}}), "重命名成功！")
+	apptest.Expect_body(t, root.Post("/rename_org", url.Values{"orgID": {"3"}, "name": {"学院A"}}), "重命名成功！")
+
+	// 移动：不能移到自身或下级组织之下，层级须合法
+	move := func(orgID int64, parentID int64) *httptest.ResponseRecorder {
+		return root.Post("/move_org", url.Values{"orgID": {fmt.Sprint(orgID)}, "higher_org": {fmt.Sprint(parentID)}})
+	}
+	apptest.Expect_body(t, move(4, 5), "移动成功！")
+	if higher_org(s, 4) != int64(5) {
+		t.Fatalf("团支部A应移到学院B之下：%v", higher_org(s, 4))
+	}
+	apptest.Expect_body(t, root.Get("/org_tree.html"), "学院B（学院）学生：2 待审核申请：1")
+	apptest.Expect_body(t, move(5, 4), "移动失败：上级组织不能是该组织本身或其下级组织")
+	apptest.Expect_body(t, move(5, 5), "移动失败：上级组织不能是该组织本身或其下级组织")
+	apptest.Expect_body(t, move(6, 1), "移动失败：组织层级不合法")
+	apptest.Expect_body(t, move(6, 99), "移动失败：上级组织不存在")
+	if higher_org(s, 5) != int64(1) || higher_org(s, 6) != int64(5) {
+		t.Fatal("移动失败时不应修改组织结构")
+	}
+
+	// 合并：只能合并同类型的组织；下级组织、学生和项目转移到目标组织，原组织及其管理员账号删除
+	apptest.Expect_body(t, root.Post("/merge_org", url.Values{"orgID": {"4"}, "target": {"3"}}), "合并失败：只能合并同类型的组织")
+	s.Exec("INSERT INTO item VALUES(2,2,4,'学院讲座',2,3,5,'学术讲座',200,'[]');")
+	apptest.Expect_body(t, root.Post("/merge_org", url.Values{"orgID": {"5"}, "target": {"3"}}), "合并成功！")
+	if higher_org(s, 5) != nil || higher_org(s, 4) != int64(3) || higher_org(s, 6) != int64(3) {
+		t.Fatal("合并后下级组织应转移到目标组织")
+	}
+	if len(s.Query("SELECT * FROM user WHERE userID='collegeB';")) != 0 {
+		t.Fatal("合并后原组织的管理员账号应删除")
+	}
+	if item, err := s.Query_one("SELECT create_org FROM item WHERE itemID=2;"); err != nil || item["create_org"] != int64(3) {
+		t.Fatalf("合并后项目应转移到目标组织：%v %v", item, err)
+	}
+	apptest.Expect_body(t, root.Get("/org_tree.html"), "学院A（学院）学生：2 待审核申请：1")
+}
+
+func TestCreateOrganization(t *testing.T) {
+	s := apptest.New_server(t)
+	school := apptest.Login(t, s, "school")
+
+	// 组织类型与上级组织须符合层级关系：单位、学院从属于学校，团支部从属于学院
+	for _, tc := range []struct {
+		org_type, parent string
+		want             string
+	}{
+		{"9", "1", "添加失败：组织层级不合法"},
+		{"2", "99", "添加失败：上级组织不存在"},
+		{"3", "1", "添加失败：组织层级不合法"},
+		{"2", "3", "添加失败：组织层级不合法"},
+		{"0", "1", "添加失败：组织层级不合法"},
+	} {
+		apptest.Expect_body(t, school.Post("/create_new_organization", url.Values{"name": {"新组织"}, "type": {tc.org_type}, "belonging_org": {tc.parent}}), tc.want)
+	}
+	if len(s.Query("SELECT * FROM organization WHERE name='新组织';")) != 0 || len(s.Query("SELECT * FROM user WHERE userID='新组织';")) != 0 {
+		t.Fatal("层级不合法的组织被创建")
+	}
+	apptest.Expect_body(t, school.Post("/create_new_organization", url.Values{"name": {"新组织"}, "type": {"2"}, "belonging_org": {"1"}}), "添加成功！")
+	apptest.Expect_body(t, school.Post("/create_new_organization", url.Values{"name": {"新团支部"}, "type": {"3"}, "belonging_org": {"3"}}), "添加成功！")
+}
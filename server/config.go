@@ -0,0 +1,363 @@
+package server
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/pelletier/go-toml/v2"
+	"gopkg.in/yaml.v2"
+)
+
+type Config struct {
+	Addr          string `toml:"addr" yaml:"addr"`                     // 监听地址
+	DB            string `toml:"db" yaml:"db"`                         // SQLite 数据库文件
+	Templates     string `toml:"templates" yaml:"templates"`           // HTML模板路径（glob）
+	Upload        string `toml:"upload" yaml:"upload"`                 // 附件存放目录
+	DefaultPasswd string `toml:"default_passwd" yaml:"default_passwd"` // 新建账号、重置密码使用的默认密码
+	PublicURL     string `toml:"public_url" yaml:"public_url"`         // 对外访问地址（https），用于生成邮件中的链接和单点登录回调地址
+	MetricsToken  string `toml:"metrics_token" yaml:"metrics_token"`   // 抓取 /metrics 使用的 Bearer 令牌，为空时不提供监控指标
+
+	ShutdownTimeout int64 `toml:"shutdown_timeout" yaml:"shutdown_timeout"` // 停止服务时等待处理中请求完成的最长时间（秒）
+	ShutdownDelay   int64 `toml:"shutdown_delay" yaml:"shutdown_delay"`     // 收到停止信号后继续接受请求的时间（秒），期间 /readyz 返回 503，供负载均衡摘除本实例
+
+	Session struct {
+		ValidTime  int64 `toml:"valid_time" yaml:"valid_time"`   // Session有效时间（秒）
+		Rotate     int64 `toml:"rotate" yaml:"rotate"`           // 定期更换SessionID的间隔（秒）
+		Grace      int64 `toml:"grace" yaml:"grace"`             // 旧SessionID的宽限期（秒）
+		ResetValid int64 `toml:"reset_valid" yaml:"reset_valid"` // 密码重置链接有效时间（秒）
+	} `toml:"session" yaml:"session"`
+
+	Cookie struct {
+		Domain   string `toml:"domain" yaml:"domain"`
+		Secure   bool   `toml:"secure" yaml:"secure"`
+		SameSite string `toml:"samesite" yaml:"samesite"` // lax、strict、none
+	} `toml:"cookie" yaml:"cookie"`
+
+	Attachment struct {
+		MaxFile   int64    `toml:"max_file" yaml:"max_file"`     // 单个附件大小上限（字节）
+		MaxTotal  int64    `toml:"max_total" yaml:"max_total"`   // 每个申请或项目的附件总大小上限（字节）
+		Types     []string `toml:"types" yaml:"types"`           // 允许上传的文件类型，按文件内容识别，不采信客户端声明的类型
+		QuotaUser int64    `toml:"quota_user" yaml:"quota_user"` // 每个学生申请附件的总配额（字节），0 表示不限
+		QuotaOrg  int64    `toml:"quota_org" yaml:"quota_org"`   // 每个组织立项附件的总配额（字节），0 表示不限
+	} `toml:"attachment" yaml:"attachment"`
+
+	Storage struct {
+		Kind          string `toml:"kind" yaml:"kind"`         // local（附件目录）或 s3（S3 兼容的对象存储）
+		Endpoint      string `toml:"endpoint" yaml:"endpoint"` // 对象存储地址，如 http://localhost:9000
+		Region        string `toml:"region" yaml:"region"`
+		Bucket        string `toml:"bucket" yaml:"bucket"`
+		AccessKey     string `toml:"access_key" yaml:"access_key"`
+		SecretKey     string `toml:"secret_key" yaml:"secret_key"`
+		Presign       bool   `toml:"presign" yaml:"presign"`               // 下载时重定向到临时链接，否则由服务器转发
+		PresignExpire int64  `toml:"presign_expire" yaml:"presign_expire"` // 临时链接有效期（秒）
+	} `toml:"storage" yaml:"storage"`
+
+	Scanner struct {
+		Kind    string `toml:"kind" yaml:"kind"`       // none（不扫描）或 clamav
+		Network string `toml:"network" yaml:"network"` // 连接 clamd 的方式：unix 或 tcp
+		Addr    string `toml:"addr" yaml:"addr"`       // clamd 的套接字路径或 主机:端口
+		Timeout int64  `toml:"timeout" yaml:"timeout"` // 扫描单个附件的最长时间（秒）
+	} `toml:"scanner" yaml:"scanner"`
+
+	TOTPRequired bool `toml:"totp_required" yaml:"totp_required"` // 是否强制管理员启用两步验证
+
+	Mail struct {
+		Addr     string `toml:"addr" yaml:"addr"` // SMTP服务器地址
+		From     string `toml:"from" yaml:"from"`
+		Username string `toml:"username" yaml:"username"` // 为空时不进行SMTP认证
+		Password string `toml:"password" yaml:"password"`
+	} `toml:"mail" yaml:"mail"`
+
+	SSO struct {
+		OIDCAuthURL      string `toml:"oidc_auth_url" yaml:"oidc_auth_url"`
+		OIDCTokenURL     string `toml:"oidc_token_url" yaml:"oidc_token_url"`
+		OIDCUserinfoURL  string `toml:"oidc_userinfo_url" yaml:"oidc_userinfo_url"`
+		OIDCClientID     string `toml:"oidc_client_id" yaml:"oidc_client_id"`
+		OIDCClientSecret string `toml:"oidc_client_secret" yaml:"oidc_client_secret"`
+		OIDCClaim        string `toml:"oidc_claim" yaml:"oidc_claim"`
+		CASURL           string `toml:"cas_url" yaml:"cas_url"`
+		CASClaim         string `toml:"cas_claim" yaml:"cas_claim"`
+		DefaultBranch    int64  `toml:"default_branch" yaml:"default_branch"`
+	} `toml:"sso" yaml:"sso"`
+}
+
+func Default_config() Config {
+	// 默认配置，测试时可在此基础上修改
+	c := Config{
+		Addr:          ":4203",
+		DB:            "data.db",
+		Templates:     "root/*",
+		Upload:        "upload/",
+		DefaultPasswd: "123456",
+		PublicURL:     "https://localhost:4203",
+
+		ShutdownTimeout: 30,
+	}
+	c.Session.ValidTime = 1800
+	c.Session.Rotate = 600
+	c.Session.Grace = 30
+	c.Session.ResetValid = 1800
+	c.Cookie.SameSite = "lax"
+	c.Attachment.MaxFile = 10 << 20
+	c.Attachment.MaxTotal = 30 << 20
+	c.Attachment.Types = []string{"application/pdf", "image/jpeg", "image/png", "image/gif", "image/webp", "text/plain", "application/zip"}
+	c.Attachment.QuotaUser = 100 << 20
+	c.Attachment.QuotaOrg = 1 << 30
+	c.Storage.Kind = "local"
+	c.Storage.Region = "us-east-1"
+	c.Storage.PresignExpire = 300
+	c.Scanner.Kind = "none"
+	c.Scanner.Network = "unix"
+	c.Scanner.Addr = "/var/run/clamav/clamd.ctl"
+	c.Scanner.Timeout = 60
+	c.Mail.Addr = "localhost:1025"
+	c.Mail.From = "noreply@localhost"
+	c.SSO.OIDCClaim = "student_number"
+	return c
+}
+
+func (c *Config) load_file(path string) error {
+	// 按扩展名读取 TOML 或 YAML 格式的配置文件，文件中未出现的配置项保持原值
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".toml":
+		err = toml.NewDecoder(bytes.NewReader(data)).DisallowUnknownFields().Decode(c)
+		var strict *toml.StrictMissingError
+		if errors.As(err, &strict) {
+			err = fmt.Errorf("%s", strict.String())
+		}
+	case ".yaml", ".yml":
+		err = yaml.UnmarshalStrict(data, c)
+	default:
+		return fmt.Errorf("无法识别的配置文件格式：%s", path)
+	}
+	if err != nil {
+		return fmt.Errorf("配置文件 %s 有误：%w", path, err)
+	}
+	return nil
+}
+
+func (c *Config) load_env() error {
+	// 环境变量覆盖配置文件
+	strs := map[string]*string{
+		"ZJUST_ADDR":               &c.Addr,
+		"ZJUST_DB":                 &c.DB,
+		"ZJUST_TEMPLATES":          &c.Templates,
+		"ZJUST_UPLOAD":             &c.Upload,
+		"ZJUST_DEFAULT_PASSWD":     &c.DefaultPasswd,
+		"ZJUST_PUBLIC_URL":         &c.PublicURL,
+		"ZJUST_COOKIE_DOMAIN":      &c.Cookie.Domain,
+		"ZJUST_COOKIE_SAMESITE":    &c.Cookie.SameSite,
+		"ZJUST_MAIL_ADDR":          &c.Mail.Addr,
+		"ZJUST_MAIL_FROM":          &c.Mail.From,
+		"ZJUST_MAIL_USERNAME":      &c.Mail.Username,
+		"ZJUST_MAIL_PASSWORD":      &c.Mail.Password,
+		"ZJUST_OIDC_AUTH_URL":      &c.SSO.OIDCAuthURL,
+		"ZJUST_OIDC_TOKEN_URL":     &c.SSO.OIDCTokenURL,
+		"ZJUST_OIDC_USERINFO_URL":  &c.SSO.OIDCUserinfoURL,
+		"ZJUST_OIDC_CLIENT_ID":     &c.SSO.OIDCClientID,
+		"ZJUST_OIDC_CLIENT_SECRET": &c.SSO.OIDCClientSecret,
+		"ZJUST_OIDC_CLAIM":         &c.SSO.OIDCClaim,
+		"ZJUST_CAS_URL":            &c.SSO.CASURL,
+		"ZJUST_CAS_CLAIM":          &c.SSO.CASClaim,
+		"ZJUST_STORAGE":            &c.Storage.Kind,
+		"ZJUST_S3_ENDPOINT":        &c.Storage.Endpoint,
+		"ZJUST_S3_REGION":          &c.Storage.Region,
+		"ZJUST_S3_BUCKET":          &c.Storage.Bucket,
+		"ZJUST_S3_ACCESS_KEY":      &c.Storage.AccessKey,
+		"ZJUST_S3_SECRET_KEY":      &c.Storage.SecretKey,
+		"ZJUST_METRICS_TOKEN":      &c.MetricsToken,
+		"ZJUST_SCANNER":            &c.Scanner.Kind,
+		"ZJUST_CLAMAV_NETWORK":     &c.Scanner.Network,
+		"ZJUST_CLAMAV_ADDR":        &c.Scanner.Addr,
+	}
+	for name, p := range strs {
+		if v, ok := os.LookupEnv(name); ok {
+			*p = v
+		}
+	}
+	ints := map[string]*int64{
+		"ZJUST_SESSION_VALID_TIME":   &c.Session.ValidTime,
+		"ZJUST_SESSION_ROTATE":       &c.Session.Rotate,
+		"ZJUST_SESSION_GRACE":        &c.Session.Grace,
+		"ZJUST_RESET_VALID_TIME":     &c.Session.ResetValid,
+		"ZJUST_SSO_DEFAULT_BRANCH":   &c.SSO.DefaultBranch,
+		"ZJUST_SHUTDOWN_TIMEOUT":     &c.ShutdownTimeout,
+		"ZJUST_SHUTDOWN_DELAY":       &c.ShutdownDelay,
+		"ZJUST_ATTACHMENT_MAX_FILE":  &c.Attachment.MaxFile,
+		"ZJUST_ATTACHMENT_MAX_TOTAL": &c.Attachment.MaxTotal,
+		"ZJUST_QUOTA_USER":           &c.Attachment.QuotaUser,
+		"ZJUST_QUOTA_ORG":            &c.Attachment.QuotaOrg,
+		"ZJUST_S3_PRESIGN_EXPIRE":    &c.Storage.PresignExpire,
+		"ZJUST_CLAMAV_TIMEOUT":       &c.Scanner.Timeout,
+	}
+	for name, p := range ints {
+		if v, ok := os.LookupEnv(name); ok {
+			n, err := strconv.ParseInt(v, 10, 64)
+			if err != nil {
+				return fmt.Errorf("环境变量 %s 应为整数", name)
+			}
+			*p = n
+		}
+	}
+	if v, ok := os.LookupEnv("ZJUST_ATTACHMENT_TYPES"); ok {
+		// 逗号分隔的MIME类型
+		c.Attachment.Types = strings.Split(v, ",")
+	}
+	bools := map[string]*bool{
+		"ZJUST_COOKIE_SECURE": &c.Cookie.Secure,
+		"ZJUST_TOTP_REQUIRED": &c.TOTPRequired,
+		"ZJUST_S3_PRESIGN":    &c.Storage.Presign,
+	}
+	for name, p := range bools {
+		if v, ok := os.LookupEnv(name); ok {
+			b, err := strconv.ParseBool(v)
+			if err != nil {
+				return fmt.Errorf("环境变量 %s 应为 1 或 0", name)
+			}
+			*p = b
+		}
+	}
+	return nil
+}
+
+func (c *Config) validate() error {
+	if c.Addr == "" {
+		return fmt.Errorf("监听地址不能为空")
+	}
+	if c.DB == "" {
+		return fmt.Errorf("数据库路径不能为空")
+	}
+	if files, err := filepath.Glob(c.Templates); err != nil || len(files) == 0 {
+		return fmt.Errorf("模板路径 %s 下没有文件", c.Templates)
+	}
+	if c.Upload == "" {
+		return fmt.Errorf("附件目录不能为空")
+	}
+	if c.Attachment.MaxFile <= 0 || c.Attachment.MaxTotal < c.Attachment.MaxFile {
+		return fmt.Errorf("附件大小上限必须大于0，且总大小上限不能小于单个附件上限")
+	}
+	if c.Attachment.QuotaUser < 0 || c.Attachment.QuotaOrg < 0 {
+		return fmt.Errorf("附件配额不能小于0")
+	}
+	for i, t := range c.Attachment.Types {
+		c.Attachment.Types[i] = strings.ToLower(strings.TrimSpace(t))
+	}
+	if c.Storage.Kind == "s3" {
+		if c.Storage.Endpoint == "" || c.Storage.Bucket == "" || c.Storage.AccessKey == "" || c.Storage.SecretKey == "" || c.Storage.Region == "" {
+			return fmt.Errorf("使用对象存储时需设置地址、存储桶、区域和访问密钥")
+		}
+		if u, err := url.Parse(c.Storage.Endpoint); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("对象存储地址有误：%s", c.Storage.Endpoint)
+		}
+		if c.Storage.PresignExpire <= 0 || c.Storage.PresignExpire > 7*24*3600 {
+			return fmt.Errorf("临时链接有效期应在 1 秒到 7 天之间")
+		}
+	} else if c.Storage.Kind != "local" {
+		return fmt.Errorf("storage.kind 应为 local 或 s3")
+	}
+	if c.Scanner.Kind == "clamav" {
+		if (c.Scanner.Network != "unix" && c.Scanner.Network != "tcp") || c.Scanner.Addr == "" {
+			return fmt.Errorf("scanner.network 应为 unix 或 tcp，且 scanner.addr 不能为空")
+		}
+		if c.Scanner.Timeout <= 0 {
+			return fmt.Errorf("附件扫描的超时时间必须大于0")
+		}
+	} else if c.Scanner.Kind != "none" {
+		return fmt.Errorf("scanner.kind 应为 none 或 clamav")
+	}
+	if c.DefaultPasswd == "" {
+		return fmt.Errorf("默认密码不能为空")
+	}
+	if u, err := url.Parse(c.PublicURL); err != nil || u.Scheme != "https" || u.Host == "" || u.RawQuery != "" || u.Fragment != "" {
+		// 邮件中的链接带有一次性令牌，只允许通过 https 访问
+		return fmt.Errorf("public_url 应为 https 地址，如 https://sutuo.example.edu：%s", c.PublicURL)
+	}
+	if c.ShutdownTimeout <= 0 {
+		return fmt.Errorf("停止服务的等待时间必须大于0")
+	}
+	if c.ShutdownDelay < 0 {
+		return fmt.Errorf("停止服务前的延迟不能小于0")
+	}
+	if c.Session.ValidTime <= 0 || c.Session.ResetValid <= 0 {
+		return fmt.Errorf("有效时间必须大于0")
+	}
+	if c.Session.Rotate <= 0 || c.Session.Grace < 0 {
+		return fmt.Errorf("SessionID 更换间隔必须大于0，宽限期不能小于0")
+	}
+	mode, ok := Samesite_modes[strings.ToLower(c.Cookie.SameSite)]
+	if !ok {
+		return fmt.Errorf("cookie.samesite 应为 lax、strict 或 none")
+	}
+	if mode == http.SameSiteNoneMode && !c.Cookie.Secure {
+		// 浏览器会拒绝未设置 Secure 的 SameSite=None Cookie
+		return fmt.Errorf("cookie.samesite 为 none 时需启用 cookie.secure")
+	}
+	oidc := []string{c.SSO.OIDCAuthURL, c.SSO.OIDCTokenURL, c.SSO.OIDCUserinfoURL, c.SSO.OIDCClientID}
+	set := 0
+	for _, v := range oidc {
+		if v != "" {
+			set++
+		}
+	}
+	if set != 0 && (set != len(oidc) || c.SSO.OIDCClaim == "") {
+		return fmt.Errorf("OIDC 配置不完整：需同时设置授权地址、令牌地址、用户信息地址、client_id 和学号字段")
+	}
+	return nil
+}
+
+func (s *Server) Check_sso_branch() error {
+	// 统一身份认证自动创建账号的默认团支部须存在且为团支部；配置校验时尚未打开数据库，在启动服务时校验
+	if s.Config.SSO.DefaultBranch == 0 {
+		return nil
+	}
+	org := s.Query(fmt.Sprintf("SELECT type FROM organization WHERE orgID=%d;", s.Config.SSO.DefaultBranch))
+	if len(org) == 0 || org[0]["type"].(int64) != 3 {
+		return fmt.Errorf("sso.default_branch 应为已存在的团支部（orgID=%d）", s.Config.SSO.DefaultBranch)
+	}
+	return nil
+}
+
+func Load_config(args []string) (Config, error) {
+	// 依次读取默认配置、配置文件、环境变量、命令行参数，后者覆盖前者
+	c := Default_config()
+	fs := flag.NewFlagSet("Gin-ZJUST", flag.ContinueOnError)
+	path := fs.String("config", os.Getenv("ZJUST_CONFIG"), "配置文件路径（.toml、.yaml）")
+	addr := fs.String("addr", "", "监听地址，如 :4203")
+	db_path := fs.String("db", "", "SQLite 数据库文件")
+	templates := fs.String("templates", "", "HTML模板路径（glob）")
+	upload := fs.String("upload", "", "附件存放目录")
+	if err := fs.Parse(args); err != nil {
+		return c, err
+	}
+	if *path != "" {
+		if err := c.load_file(*path); err != nil {
+			return c, err
+		}
+	}
+	if err := c.load_env(); err != nil {
+		return c, err
+	}
+	for _, f := range []struct{ v, p *string }{{addr, &c.Addr}, {db_path, &c.DB}, {templates, &c.Templates}, {upload, &c.Upload}} {
+		if *f.v != "" {
+			*f.p = *f.v
+		}
+	}
+	return c, c.validate()
+}
+
+func (c *Config) Public_link(path string) string {
+	// 根据配置的对外访问地址生成完整链接，不使用请求中的 Host，避免被伪造
+	return strings.TrimSuffix(c.PublicURL, "/") + path
+}
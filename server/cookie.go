@@ -0,0 +1,32 @@
+package server
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+var Samesite_modes = map[string]http.SameSite{
+	"lax":    http.SameSiteLaxMode,
+	"strict": http.SameSiteStrictMode,
+	"none":   http.SameSiteNoneMode,
+}
+
+func (s *Server) Set_cookie(c *gin.Context, name string, value string, max_age int) {
+	// max_age 为0时为会话Cookie，登录的有效期以服务端Session为准
+	c.SetSameSite(Samesite_modes[strings.ToLower(s.Config.Cookie.SameSite)])
+	c.SetCookie(name, value, max_age, "/", s.Config.Cookie.Domain, s.Config.Cookie.Secure, true)
+}
+
+func (s *Server) Start_session(c *gin.Context, userID string) {
+	// 为登录成功的用户生成Session
+	s.Set_cookie(c, "SessionID", s.Sessions.Start(userID), 0)
+}
+
+func (s *Server) Renew_session(c *gin.Context) {
+	// 当前用户的权限发生变化后立即更换SessionID
+	if newID, ok := s.Sessions.Rotate(c.GetString("userID")); ok {
+		s.Set_cookie(c, "SessionID", newID, 0)
+	}
+}
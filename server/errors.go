@@ -0,0 +1,95 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"runtime/debug"
+
+	"github.com/gin-gonic/gin"
+)
+
+type Error struct {
+	Status int    // HTTP状态码
+	Code   string // JSON接口中的错误码
+	Msg    string // 展示给用户的提示
+	err    error  // 原始错误，只记录在日志中，不展示给用户
+}
+
+func (e *Error) Error() string {
+	return e.Msg
+}
+
+func (e *Error) Unwrap() error {
+	return e.err
+}
+
+var Err_not_found = &Error{Status: http.StatusNotFound, Code: "not_found", Msg: "记录不存在"}                    // 申请、项目等记录不存在
+var Err_forbidden = &Error{Status: http.StatusForbidden, Code: "forbidden", Msg: "权限不足"}                    // 不在管辖范围内或不处于可操作的状态
+var Err_bad_request = &Error{Status: http.StatusBadRequest, Code: "bad_request", Msg: "输入有误"}               // 请求参数不合法
+var Err_item_closed = &Error{Status: http.StatusConflict, Code: "item_closed", Msg: "该项目已停止申请"}             // 申请已停止申请的项目
+var Err_account_deleted = &Error{Status: http.StatusUnauthorized, Code: "unauthorized", Msg: "账号不存在，请重新登录"} // 登录期间账号已被删除
+var Err_internal = &Error{Status: http.StatusInternalServerError, Code: "internal", Msg: "服务器内部错误"}
+
+func Internal(err error) error {
+	// 数据库、文件等出错，向用户隐藏具体原因
+	return &Error{Status: Err_internal.Status, Code: Err_internal.Code, Msg: Err_internal.Msg, err: err}
+}
+
+func As_error(err error) *Error {
+	var e *Error
+	if errors.As(err, &e) {
+		return e
+	}
+	return Internal(err).(*Error)
+}
+
+func (s *Server) Fail(c *gin.Context, err error) {
+	// 统一返回错误：JSON接口返回错误对象，页面渲染错误页；服务器内部错误记录日志
+	e := As_error(err)
+	if e.Status >= http.StatusInternalServerError && e.err != nil {
+		s.Req_log(c).Error("请求处理失败", "error", db_error(e.err))
+	}
+	if Is_api(c) {
+		Api_error(c, e.Status, e.Code, e.Msg)
+		return
+	}
+	c.HTML(e.Status, "error.html", gin.H{
+		"msg":        e.Msg,
+		"request_id": c.GetString("request_id"),
+	})
+	c.Abort()
+}
+
+func (s *Server) Handle(h func(c *gin.Context) error) gin.HandlerFunc {
+	// 处理函数返回错误时由 Fail 统一响应
+	return func(c *gin.Context) {
+		if err := h(c); err != nil {
+			s.Fail(c, err)
+		}
+	}
+}
+
+func (s *Server) Midware_Recover(c *gin.Context) {
+	// 处理函数panic时记录日志并返回错误页，不中断服务
+	defer func() {
+		if r := recover(); r != nil {
+			s.Req_log(c).Error("处理请求时发生panic", "panic", fmt.Sprint(r), "stack", string(debug.Stack()))
+			if c.Writer.Written() {
+				c.Abort()
+				return
+			}
+			s.Fail(c, Err_internal)
+		}
+	}()
+	c.Next()
+}
+
+func (s *Server) Query_one(sql string) (map[string]any, error) {
+	// 查询单条记录，不存在时返回 Err_not_found
+	res := s.Query(sql)
+	if len(res) == 0 {
+		return nil, Err_not_found
+	}
+	return res[0], nil
+}
@@ -0,0 +1,86 @@
+package server
+
+import (
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mattn/go-sqlite3"
+)
+
+var request_id_pattern = regexp.MustCompile(`^[A-Za-z0-9._-]{1,64}$`) // 沿用反向代理传入的请求ID
+
+func New_logger(w io.Writer) *slog.Logger {
+	return slog.New(slog.NewJSONHandler(w, nil))
+}
+
+func (s *Server) Midware_Log(c *gin.Context) {
+	// 为每个请求分配请求ID，请求结束后记录访问日志
+	// 只记录路径不记录查询参数，避免密码重置令牌、学号等出现在日志中
+	id := c.GetHeader("X-Request-ID")
+	if !request_id_pattern.MatchString(id) {
+		id = Produce_token()
+	}
+	c.Set("request_id", id)
+	c.Header("X-Request-ID", id)
+	start := time.Now()
+
+	c.Next()
+
+	status := c.Writer.Status()
+	level := slog.LevelInfo
+	if status >= http.StatusInternalServerError {
+		level = slog.LevelError
+	}
+	s.Req_log(c).Log(c.Request.Context(), level, "request",
+		"method", c.Request.Method,
+		"path", c.Request.URL.Path,
+		"status", status,
+		"latency_ms", time.Since(start).Milliseconds(),
+		"ip", c.ClientIP(),
+		"size", c.Writer.Size(),
+	)
+}
+
+func (s *Server) Req_log(c *gin.Context) *slog.Logger {
+	// 附带请求ID与当前用户的日志对象，userID、account_type 由登录校验中间件写入
+	l := s.Log.With("request_id", c.GetString("request_id"))
+	if userID := c.GetString("userID"); userID != "" {
+		l = l.With("userID", userID)
+	}
+	if account_type, ok := c.Get("account_type"); ok {
+		l = l.With("account_type", account_type)
+	}
+	return l
+}
+
+func (s *Server) Log_db_error(c *gin.Context, msg string, sql string, err error) {
+	// 记录数据库错误；SQL中拼接了用户数据，只记录语句类型
+	// 处理请求时传入 c，日志附带请求ID与当前用户；s.Query 等不在请求中调用的场合传入 nil
+	l := s.Log
+	if c != nil {
+		l = s.Req_log(c)
+	}
+	l.Error(msg, "op", sql_op(sql), "error", db_error(err))
+}
+
+func sql_op(sql string) string {
+	if fields := strings.Fields(sql); len(fields) > 0 {
+		return strings.ToUpper(fields[0])
+	}
+	return ""
+}
+
+func db_error(err error) string {
+	// SQLite 的语法错误信息会引用出错位置附近的语句内容，只保留错误码
+	var e sqlite3.Error
+	if errors.As(err, &e) {
+		return e.ExtendedCode.Error()
+	}
+	return err.Error()
+}
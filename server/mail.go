@@ -0,0 +1,46 @@
+package server
+
+import (
+	"fmt"
+	"mime"
+	"net/smtp"
+	"strings"
+)
+
+type Mailer interface {
+	Send(to string, subject string, body string) error
+}
+
+type smtp_mailer struct {
+	addr string // SMTP服务器地址，如 localhost:1025
+	from string // 发件人地址
+	auth smtp.Auth
+}
+
+func new_smtp_mailer(c Config) *smtp_mailer {
+	m := &smtp_mailer{
+		addr: c.Mail.Addr,
+		from: c.Mail.From,
+	}
+	if c.Mail.Username != "" {
+		host, _, _ := strings.Cut(c.Mail.Addr, ":")
+		m.auth = smtp.PlainAuth("", c.Mail.Username, c.Mail.Password, host)
+	}
+	return m
+}
+
+func (m *smtp_mailer) Send(to string, subject string, body string) error {
+	msg := strings.Join([]string{
+		"From: " + m.from,
+		"To: " + to,
+		"Subject: " + mime.BEncoding.Encode("UTF-8", subject),
+		"MIME-Version: 1.0",
+		"Content-Type: text/plain; charset=UTF-8",
+		"",
+		body,
+	}, "\r\n")
+	if err := smtp.SendMail(m.addr, m.auth, m.from, []string{to}, []byte(msg)); err != nil {
+		return fmt.Errorf("发送邮件失败：%w", err)
+	}
+	return nil
+}
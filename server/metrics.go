@@ -0,0 +1,129 @@
+package server
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+)
+
+var audit_level = map[int64]string{ // 管理员类型 to 审核级别
+	0: "school",
+	1: "school",
+	3: "college",
+	4: "branch",
+}
+
+var pending_level = map[string]int64{ // 审核级别 to 等待该级别审核的申请状态
+	"branch":  0,
+	"college": 1,
+	"school":  3,
+}
+
+type Metrics struct {
+	Registry *prometheus.Registry // 每个Server使用独立的注册表，便于测试时创建多个Server
+
+	http_duration      *prometheus.HistogramVec
+	appliances_created *prometheus.CounterVec
+	appliance_audits   *prometheus.CounterVec
+	upload_bytes       *prometheus.CounterVec
+}
+
+func new_metrics(s *Server) *Metrics {
+	m := &Metrics{
+		Registry: prometheus.NewRegistry(),
+		http_duration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "zjust_http_request_duration_seconds",
+			Help:    "HTTP请求处理耗时，按路由统计",
+			Buckets: prometheus.DefBuckets,
+		}, []string{"method", "route", "status"}),
+		appliances_created: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "zjust_appliances_created_total",
+			Help: "新建的申请数，source 为 apply（页面申请）、api（JSON接口）或 import（导入名单）",
+		}, []string{"source"}),
+		appliance_audits: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "zjust_appliance_audits_total",
+			Help: "各级审核通过、不通过的申请数",
+		}, []string{"level", "result"}),
+		upload_bytes: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "zjust_upload_bytes_total",
+			Help: "保存的附件字节数，kind 为 appliance（申请附件）或 item（立项附件）",
+		}, []string{"kind"}),
+	}
+	m.Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		m.http_duration,
+		m.appliances_created,
+		m.appliance_audits,
+		m.upload_bytes,
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Name: "zjust_active_sessions",
+			Help: "未过期的登录Session数",
+		}, func() float64 {
+			return float64(s.Sessions.Active())
+		}),
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Name: "zjust_pending_activity_items",
+			Help: "等待校级审核的立项项目数",
+		}, func() float64 {
+			return s.count("SELECT COUNT(*) AS n FROM item WHERE status IN (1,2);")
+		}),
+	)
+	for level, status := range pending_level {
+		// 待审核数在抓取时从数据库统计
+		sql := "SELECT COUNT(*) AS n FROM appliance WHERE status=" + strconv.FormatInt(status, 10) + ";"
+		m.Registry.MustRegister(prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Name:        "zjust_pending_appliances",
+			Help:        "等待各级审核的申请数",
+			ConstLabels: prometheus.Labels{"level": level},
+		}, func() float64 {
+			return s.count(sql)
+		}))
+	}
+	return m
+}
+
+func (s *Server) count(sql string) float64 {
+	res := s.Query(sql)
+	if len(res) == 0 {
+		return 0
+	}
+	n, _ := res[0]["n"].(int64)
+	return float64(n)
+}
+
+func (s *Server) Midware_Metrics(c *gin.Context) {
+	// 按路由模板统计耗时，未匹配的路径统一记为 unmatched，避免标签数量无限增长
+	start := time.Now()
+	c.Next()
+	route := c.FullPath()
+	if route == "" {
+		route = "unmatched"
+	}
+	s.Metrics.http_duration.WithLabelValues(c.Request.Method, route, strconv.Itoa(c.Writer.Status())).Observe(time.Since(start).Seconds())
+}
+
+func (m *Metrics) Appliance_created(source string) {
+	m.appliances_created.WithLabelValues(source).Inc()
+}
+
+func (m *Metrics) Appliance_audited(account_type int64, pass bool, n int64) {
+	// 记录 account_type 对应级别审核的 n 条申请
+	result := "rejected"
+	if pass {
+		result = "approved"
+	}
+	level, ok := audit_level[account_type]
+	if !ok {
+		// 没有对应审核级别的账号类型统一记为 other，不产生空标签
+		level = "other"
+	}
+	m.appliance_audits.WithLabelValues(level, result).Add(float64(n))
+}
+
+func (m *Metrics) Uploaded(kind string, size int64) {
+	m.upload_bytes.WithLabelValues(kind).Add(float64(size))
+}
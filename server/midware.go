@@ -0,0 +1,113 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+var totp_enroll_path = map[string]bool{ // 强制启用两步验证时，尚未启用的管理员可访问的页面
+	"/manage_self_info.html": true,
+	"/totp_enroll":           true,
+	"/totp_confirm":          true,
+}
+
+func Is_api(c *gin.Context) bool {
+	return strings.HasPrefix(c.Request.URL.Path, "/api/")
+}
+
+func Api_error(c *gin.Context, status int, code string, msg string) {
+	c.AbortWithStatusJSON(status, gin.H{
+		"error": gin.H{
+			"code":    code,
+			"message": msg,
+		},
+	})
+}
+
+func (s *Server) Midware_Auth(c *gin.Context) {
+
+	if auth := c.GetHeader("Authorization"); Is_api(c) && strings.HasPrefix(auth, "Bearer ") {
+		// JSON 接口可使用API令牌代替SessionID
+		s.token_auth(c, strings.TrimSpace(strings.TrimPrefix(auth, "Bearer ")))
+	} else if cookie, err := c.Request.Cookie("SessionID"); err == nil {
+		// 获得了SessionID
+		SessionID := cookie.Value
+		newID, info, OK := s.Sessions.Touch(SessionID)
+		if OK {
+			// Session尚未过期，重置Session时间；SessionID已更换时下发新的cookie
+			if newID != SessionID {
+				s.Set_cookie(c, "SessionID", newID, 0)
+			}
+			c.Set("login_status", true)
+			s.set_actor(c, info["userID"].(string))
+			if enroll, _ := info["totp_enroll"].(bool); enroll && !totp_enroll_path[c.Request.URL.Path] {
+				// 系统要求启用两步验证，尚未启用前只能访问设置页面
+				c.Redirect(http.StatusFound, "/manage_self_info.html")
+				c.Abort()
+			}
+		} else if Is_api(c) {
+			Api_error(c, http.StatusUnauthorized, "unauthorized", "登录已过期，请重新登录后访问")
+		} else {
+			// Session已过期，跳转到登录界面
+			c.HTML(http.StatusOK, "login.html", gin.H{
+				"msg": "登录已过期，请重新登录后访问",
+			})
+			c.Abort()
+		}
+	} else if Is_api(c) {
+		Api_error(c, http.StatusUnauthorized, "unauthorized", "请登录后访问")
+	} else {
+		//未获得SessionID, 跳转到登录页面
+		c.HTML(http.StatusOK, "login.html", gin.H{
+			"msg": "请登录后访问",
+		})
+		c.Abort()
+	}
+}
+
+func (s *Server) set_actor(c *gin.Context, userID string) {
+	// 记录当前用户，供后续处理与日志使用
+	c.Set("userID", userID)
+	if res := s.Query(fmt.Sprintf("SELECT account_type FROM user WHERE userID=%s;", Join_strs([]string{userID}))); len(res) > 0 {
+		c.Set("account_type", res[0]["account_type"].(int64))
+	}
+}
+
+func (s *Server) Authorities(auth int) gin.HandlerFunc {
+	// 从高位到低位依次代表学生用户、团支部账号、学院账号、单位账号、校级账号、超级管理员是否拥有访问权限
+	return func(c *gin.Context) {
+		userID := c.GetString("userID")
+		sql := fmt.Sprintf("SELECT account_type,belonging_org FROM user WHERE userID=\"%s\";", userID)
+		user, err := s.Query_one(sql)
+		if err != nil {
+			s.Fail(c, Err_account_deleted)
+			return
+		}
+		account_type := user["account_type"].(int64)
+		if auth&(1<<account_type) == 0 && Is_api(c) {
+			Api_error(c, http.StatusForbidden, "forbidden", "权限不足")
+		} else if auth&(1<<account_type) == 0 {
+			c.String(http.StatusOK, "权限不足！")
+			c.Abort()
+		} else {
+			c.Set("account_type", account_type)
+			c.Set("belonging_org", user["belonging_org"].(int64)) // 管理员所属组织一律以 belonging_org 为准
+		}
+	}
+}
+
+func (s *Server) Permission(perm int) gin.HandlerFunc {
+	// 校验受委派的管理员是否被授予了对应功能，需在 Authorities 之后使用
+	return func(c *gin.Context) {
+		granted := s.User_authorities(c.GetString("userID"), c.GetInt64("account_type"))&perm != 0
+		if !granted && Is_api(c) {
+			Api_error(c, http.StatusForbidden, "forbidden", "权限不足")
+		} else if !granted {
+			c.String(http.StatusOK, "权限不足！")
+			c.Abort()
+		}
+	}
+}
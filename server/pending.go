@@ -0,0 +1,46 @@
+package server
+
+import (
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+type Pending_base struct {
+	m sync.Map
+	/* 键：字符串类型，TwoFactorID
+	 * 值：gin.H 类型，用户名(userID)，过期时间(due)，输错动态口令的次数(failures) */
+}
+
+func (pb *Pending_base) Start(userID string, valid_time int64) string {
+	// 记录已通过密码验证、等待动态口令的登录，返回 TwoFactorID
+	// 同时清理已过期、未完成的登录，避免只输入了密码的登录长期占用内存
+	now := time.Now().Unix()
+	pb.m.Range(func(key, value any) bool {
+		if now > value.(gin.H)["due"].(int64) {
+			pb.m.Delete(key)
+		}
+		return true
+	})
+	id := Produce_token()
+	pb.m.Store(id, gin.H{
+		"userID":   userID,
+		"due":      now + valid_time,
+		"failures": 0,
+	})
+	return id
+}
+
+func (pb *Pending_base) Take(id string) (gin.H, bool) {
+	// 取出未过期的登录；同一登录的并发尝试只有一个能取到，校验失败且可重试时由调用方用 Put 放回
+	value, ok := pb.m.LoadAndDelete(id)
+	if !ok || time.Now().Unix() > value.(gin.H)["due"].(int64) {
+		return nil, false
+	}
+	return value.(gin.H), true
+}
+
+func (pb *Pending_base) Put(id string, info gin.H) {
+	pb.m.Store(id, info)
+}
@@ -0,0 +1,52 @@
+package server
+
+import (
+	"fmt"
+
+	"github.com/gin-gonic/gin"
+)
+
+const ( // 后台功能权限位，与个人中心页面的功能入口一一对应
+	Perm_add_item = 1 << iota
+	Perm_add_basic_item
+	Perm_apply
+	Perm_audit_added
+	Perm_audit_basic
+	Perm_check_branch_info
+	Perm_check_record
+	Perm_check_student_info
+	Perm_create_new_org
+	Perm_create_new_manager
+	Perm_item_anal
+	Perm_manage_self_info
+	Perm_import_new_student
+	Perm_manage_admins
+)
+
+var Account_authorities = map[int64]int{ // 账号类型 to 可使用的功能
+	0: 0b00111110011010, // 超级管理员
+	1: 0b00111110011000, // 校级管理员
+	2: 0b00100000000001, // 单位管理员
+	3: 0b10100010110001, // 学院管理员
+	4: 0b11100010010000, // 团支部管理员
+	5: 0b00100001000100, // 普通学生
+}
+
+var Delegable_permissions = []gin.H{ // 学院、团支部管理员可授予本组织其他管理员的功能
+	{"bit": Perm_add_item, "name": "非基础项目立项"},
+	{"bit": Perm_audit_basic, "name": "基础项目审核"},
+	{"bit": Perm_check_branch_info, "name": "查看团支部信息"},
+	{"bit": Perm_check_student_info, "name": "查看学生信息"},
+	{"bit": Perm_import_new_student, "name": "学生信息导入"},
+	{"bit": Perm_manage_admins, "name": "本组织管理员管理"},
+}
+
+func (s *Server) User_authorities(userID string, account_type int64) int {
+	// 计算用户可使用的功能：账号类型对应的功能，受委派的管理员还需与被授予的权限取交集
+	auth := Account_authorities[account_type]
+	sql := fmt.Sprintf("SELECT permissions FROM admin_permission WHERE userID=%s;", Join_strs([]string{userID}))
+	if res := s.Query(sql); len(res) > 0 {
+		auth &= int(res[0]["permissions"].(int64)) | Perm_manage_self_info
+	}
+	return auth
+}
@@ -0,0 +1,92 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"time"
+)
+
+// Scanner 在保存前扫描上传的附件，返回发现的威胁名称，未发现威胁时返回空字符串
+type Scanner interface {
+	Scan(ctx context.Context, r io.Reader) (string, error)
+}
+
+func new_scanner(c Config) Scanner {
+	if c.Scanner.Kind == "clamav" {
+		return &clamav_scanner{
+			network: c.Scanner.Network,
+			addr:    c.Scanner.Addr,
+			timeout: time.Duration(c.Scanner.Timeout) * time.Second,
+		}
+	}
+	return noop_scanner{}
+}
+
+type noop_scanner struct{}
+
+func (noop_scanner) Scan(ctx context.Context, r io.Reader) (string, error) {
+	// 不扫描，全部视为安全
+	return "", nil
+}
+
+type clamav_scanner struct {
+	network string // unix 或 tcp
+	addr    string // clamd 的套接字路径或地址
+	timeout time.Duration
+}
+
+const clamav_chunk = 64 << 10 // INSTREAM 每次发送的数据块大小
+
+func (cs *clamav_scanner) Scan(ctx context.Context, r io.Reader) (string, error) {
+	// 使用 clamd 的 INSTREAM 命令：每个数据块前附 4 字节大端长度，以长度为 0 的数据块结束，
+	// 返回 "stream: OK" 或 "stream: 威胁名称 FOUND"
+	ctx, cancel := context.WithTimeout(ctx, cs.timeout)
+	defer cancel()
+	conn, err := (&net.Dialer{}).DialContext(ctx, cs.network, cs.addr)
+	if err != nil {
+		return "", fmt.Errorf("无法连接 clamd：%w", err)
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	if _, err = conn.Write([]byte("zINSTREAM\x00")); err != nil {
+		return "", err
+	}
+	buf := make([]byte, 4+clamav_chunk)
+	for {
+		n, err := io.ReadFull(r, buf[4:])
+		if n > 0 {
+			binary.BigEndian.PutUint32(buf, uint32(n))
+			if _, err := conn.Write(buf[:4+n]); err != nil {
+				return "", err
+			}
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			break
+		} else if err != nil {
+			return "", err
+		}
+	}
+	if _, err = conn.Write([]byte{0, 0, 0, 0}); err != nil {
+		return "", err
+	}
+	reply, err := bufio.NewReader(conn).ReadString(0)
+	if err != nil && reply == "" {
+		return "", fmt.Errorf("读取 clamd 扫描结果失败：%w", err)
+	}
+	reply = strings.TrimSpace(strings.TrimSuffix(reply, "\x00"))
+	result := strings.TrimPrefix(reply, "stream: ")
+	switch {
+	case result == "OK":
+		return "", nil
+	case strings.HasSuffix(result, " FOUND"):
+		return strings.TrimSuffix(result, " FOUND"), nil
+	}
+	return "", fmt.Errorf("clamd 扫描失败：%s", reply)
+}
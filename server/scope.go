@@ -0,0 +1,73 @@
+package server
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+func Join_ids(ids []int64) string {
+	// 将ID列表拼接为 SQL IN 子句可用的字符串，空列表返回 "NULL"，使 IN (NULL) 不匹配任何记录
+	if len(ids) == 0 {
+		return "NULL"
+	}
+	strs := make([]string, 0, len(ids))
+	for _, id := range ids {
+		strs = append(strs, strconv.FormatInt(id, 10))
+	}
+	return strings.Join(strs, ",")
+}
+
+func Join_strs(strs []string) string {
+	// 将字符串列表拼接为 SQL IN 子句可用的字符串，单引号按SQL规则转义
+	if len(strs) == 0 {
+		return "NULL"
+	}
+	quoted := make([]string, 0, len(strs))
+	for _, s := range strs {
+		quoted = append(quoted, "'"+strings.ReplaceAll(s, "'", "''")+"'")
+	}
+	return strings.Join(quoted, ",")
+}
+
+func (s *Server) Org_name(orgID int64) string {
+	// 查询组织名称，组织不存在时返回空字符串
+	org := s.Query(fmt.Sprintf("SELECT name FROM organization WHERE orgID=%d;", orgID))
+	if len(org) == 0 {
+		return ""
+	}
+	return org[0]["name"].(string)
+}
+
+func Scope_orgs(account_type int64, orgID int64) string {
+	// 管理员管辖范围内学生可能所属的组织，返回 SQL 条件
+	// 团支部管理员：本团支部；学院管理员：下属团支部；学校管理员、超级管理员：全部组织
+	if account_type == 4 {
+		return fmt.Sprintf("user.belonging_org=%d", orgID)
+	} else if account_type == 3 {
+		return fmt.Sprintf("user.belonging_org IN (SELECT orgID FROM organization WHERE higher_org=%d)", orgID)
+	} else if account_type == 1 || account_type == 0 {
+		return "1=1"
+	}
+	return "1=0"
+}
+
+func (s *Server) Students_in_scope(account_type int64, orgID int64) []map[string]any {
+	// 查询管理员管辖范围内的学生，字段：name（学号）、belonging_org（所属团支部名称）
+	sql := fmt.Sprintf("SELECT user.userID AS name,organization.name AS belonging_org FROM user,organization WHERE user.account_type=5 AND user.belonging_org=organization.orgID AND %s;", Scope_orgs(account_type, orgID))
+	return s.Query(sql)
+}
+
+func (s *Server) Student_in_scope(account_type int64, orgID int64, userID string) bool {
+	// 判断学生是否处于管理员管辖范围内
+	sql := fmt.Sprintf("SELECT userID FROM user WHERE account_type=5 AND userID=%s AND %s;", Join_strs([]string{userID}), Scope_orgs(account_type, orgID))
+	return len(s.Query(sql)) > 0
+}
+
+// 学生可浏览、申请的项目：基础项目，以及审核通过的非基础项目
+const Catalogue_items = "(item.type IN (0,1) OR item.status=4)"
+
+func (s *Server) Item_open(itemID int64) bool {
+	// 项目是否接受申请，维护者可停止申请（见 item_closed 表）
+	return len(s.Query(fmt.Sprintf("SELECT itemID FROM item_closed WHERE itemID=%d;", itemID))) == 0
+}
@@ -0,0 +1,78 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+func (s *Server) Run() error {
+	// 启动HTTP服务，收到 SIGINT/SIGTERM 后不再接受新连接，等待处理中的请求完成后关闭数据库
+	if err := s.Check_sso_branch(); err != nil {
+		s.DB.Close()
+		return err
+	}
+	srv := &http.Server{
+		Addr:              s.Config.Addr,
+		Handler:           s.Router,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	errs := make(chan error, 1)
+	go func() {
+		s.Log.Info("Listening", "addr", s.Config.Addr)
+		errs <- srv.ListenAndServe()
+	}()
+	select {
+	case err := <-errs:
+		// 端口被占用等原因导致服务未能启动
+		s.DB.Close()
+		return err
+	case <-ctx.Done():
+	}
+	stop() // 再次收到信号时直接退出
+
+	// 先让 /readyz 返回 503，等待负载均衡发现后不再转发新请求，期间仍正常处理请求
+	s.draining.Store(true)
+	if s.Config.ShutdownDelay > 0 {
+		s.Log.Info("等待负载均衡摘除本实例", "delay_s", s.Config.ShutdownDelay)
+		time.Sleep(time.Duration(s.Config.ShutdownDelay) * time.Second)
+	}
+	s.Log.Info("正在停止服务", "timeout_s", s.Config.ShutdownTimeout)
+	timeout, cancel := context.WithTimeout(context.Background(), time.Duration(s.Config.ShutdownTimeout)*time.Second)
+	defer cancel()
+	err := srv.Shutdown(timeout)
+	if errors.Is(err, context.DeadlineExceeded) {
+		err = fmt.Errorf("等待超时，仍有请求未处理完成")
+		srv.Close()
+	}
+	s.DB.Close()
+	return err
+}
+
+func (s *Server) Ready() error {
+	// 检查服务能否处理请求：未在停止中、数据库可访问、附件存储可写
+	if s.draining.Load() {
+		return fmt.Errorf("服务正在停止")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if err := s.DB.PingContext(ctx); err != nil {
+		return fmt.Errorf("数据库无法访问：%w", err)
+	}
+	var n int
+	if err := s.DB.GetContext(ctx, &n, "SELECT 1;"); err != nil {
+		return fmt.Errorf("数据库无法查询：%w", err)
+	}
+	if err := s.Storage.Check(ctx); err != nil {
+		return fmt.Errorf("附件存储不可写：%w", err)
+	}
+	return nil
+}
@@ -0,0 +1,195 @@
+package server
+
+import (
+	"fmt"
+	"html/template"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync/atomic"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jmoiron/sqlx"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// Server 持有各模块共用的数据库、Session库与配置，由各功能包在其上注册路由
+type Server struct {
+	Config      Config        // 服务配置
+	DB          *sqlx.DB      // 数据库对象
+	Sessions    *Session_base // Session库对象
+	Pending     *Pending_base // 等待动态口令的登录
+	Mailer      Mailer        // 邮件发送对象
+	Storage     Storage       // 附件存储
+	Scanner     Scanner       // 上传附件的病毒扫描
+	Log         *slog.Logger  // JSON格式的结构化日志
+	Metrics     *Metrics      // Prometheus 监控指标
+	Router      *gin.Engine
+	Upload_root string // 附件存放目录，以 / 结尾
+
+	draining atomic.Bool // 收到停止信号后置为 true，/readyz 随即返回未就绪
+}
+
+var Account_types = map[int64]string{
+	0: "超级管理员",
+	1: "校级管理员",
+	2: "单位管理员",
+	3: "学院管理员",
+	4: "团支部管理员",
+	5: "学生",
+}
+
+var Org_type = map[int64]string{
+	0: "学校",
+	1: "单位",
+	2: "学院",
+	3: "团支部",
+}
+
+var Item_types = map[int64]string{
+	0: "第二课堂",
+	1: "第三课堂",
+	2: "第二课堂",
+	3: "第三课堂",
+}
+
+var Appliance_status = map[int64]string{
+	0: "待审核",
+	1: "团支部审核通过",
+	2: "团支部审核不通过",
+	3: "学院审核通过",
+	4: "学院审核不通过",
+	5: "学校审核通过",
+	6: "学校审核不通过",
+}
+
+var Item_status = map[int64]string{
+	1: "待审核",
+	2: "预审核通过",
+	3: "预审核不通过",
+	4: "审核通过",
+	5: "审核不通过",
+}
+
+var To_audit_map = map[int64]int64{ // 管理员类型 to 可操作项目状态
+	0: 3,
+	1: 3, //校级管理员和超级管理员可审核学院审核已通过的项目
+	3: 1, //学院管理员可审核团支部审核已通过的项目
+	4: 0, //团支部管理员可审核尚未进行团支部审核的项目
+}
+
+func New(c Config) (*Server, error) {
+	// 打开数据库、创建数据表并加载HTML模板，路由由各功能包注册
+	// 数据库为 :memory: 时使用内存数据库，供测试使用
+	if err := os.MkdirAll(c.Upload, os.ModePerm); err != nil {
+		return nil, fmt.Errorf("无法创建附件目录：%w", err)
+	}
+	db, err := sqlx.Open("sqlite3", c.DB)
+	if err != nil {
+		return nil, err
+	}
+	if c.DB == ":memory:" {
+		// 内存数据库的每个连接都是独立的数据库，只保留一个连接
+		db.SetMaxOpenConns(1)
+	}
+	c.SSO.CASURL = strings.TrimSuffix(c.SSO.CASURL, "/")
+	s := &Server{
+		Config:      c,
+		DB:          db,
+		Sessions:    New_session_base(c.Session.ValidTime, c.Session.Rotate, c.Session.Grace),
+		Pending:     &Pending_base{},
+		Upload_root: strings.TrimSuffix(filepath.ToSlash(c.Upload), "/") + "/",
+		Log:         New_logger(os.Stdout),
+	}
+	s.Mailer = new_smtp_mailer(c)
+	s.Scanner = new_scanner(c)
+	if s.Storage, err = new_storage(c, s.Upload_root); err != nil {
+		db.Close()
+		return nil, err
+	}
+	s.Metrics = new_metrics(s)
+	if err = s.create_tables(); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	r := gin.New()
+	r.Use(s.Midware_Log, s.Midware_Metrics, s.Midware_Recover) // 以结构化日志代替 gin 默认的访问日志
+	r.SetFuncMap(template.FuncMap{
+		"strcat":         strcat,
+		"strcat1":        strcat1,
+		"show_list":      show_list,
+		"show_operation": show_operation,
+		"sso_enabled":    s.Sso_enabled,
+	})
+	r.LoadHTMLGlob(c.Templates) // 加载HTML模板根目录
+	s.Router = r
+	return s, nil
+}
+
+func (s *Server) Query(sql string) []map[string]any {
+	return s.Query_with(s.DB, sql)
+}
+
+func (s *Server) Query_with(q sqlx.Queryer, sql string) []map[string]any {
+	// 在事务中查询时传入 tx；数据库只有一个连接，事务进行中不能再使用 s.Query
+	res := []map[string]any{}
+	rows, err := q.Queryx(sql)
+	if err != nil {
+		s.Log_db_error(nil, "数据库查询失败", sql, err)
+		return res
+	}
+	defer rows.Close()
+	for rows.Next() {
+		temp := map[string]any{}
+		if err = rows.MapScan(temp); err != nil {
+			s.Log_db_error(nil, "读取查询结果失败", sql, err)
+			continue
+		}
+		res = append(res, temp)
+	}
+	if err = rows.Err(); err != nil {
+		s.Log_db_error(nil, "读取查询结果失败", sql, err)
+	}
+	return res
+}
+
+func (s *Server) Exec(sql string) bool {
+	_, err := s.DB.Exec(sql)
+	if err != nil {
+		s.Log_db_error(nil, "数据库操作失败", sql, err)
+	}
+	return err == nil
+}
+
+func (s *Server) Upload_file(path string) string {
+	// 将链接中的附件路径（upload/...）转换为附件目录中的路径
+	return s.Upload_root + strings.TrimPrefix(path, "upload/")
+}
+
+func (s *Server) Sso_enabled(kind string) bool {
+	if kind == "oidc" {
+		return s.Config.SSO.OIDCAuthURL != "" && s.Config.SSO.OIDCTokenURL != "" && s.Config.SSO.OIDCUserinfoURL != ""
+	} else if kind == "cas" {
+		return s.Config.SSO.CASURL != ""
+	}
+	return false
+}
+
+func strcat(a, b string) string {
+	return a + b
+}
+func strcat1(a string, b int64) string {
+	c := int(b)
+	return a + strconv.Itoa(c)
+}
+
+func show_list(a string) bool {
+	return a == "预审核通过" || a == "审核通过" || a == "审核不通过"
+}
+
+func show_operation(a string) bool {
+	return a == "待审核" || a == "预审核通过"
+}
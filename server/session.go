@@ -0,0 +1,203 @@
+package server
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+type Session_base struct {
+	mu sync.Mutex // 并发请求可能同时读写同一Session，读写Session内容时需加锁
+
+	m sync.Map
+	/* 键：字符串类型，SessionID
+	 * 值：gin.H 类型，用户名（userID)，过期时间(due)，上次更换SessionID的时间(rotated) */
+
+	user2ID sync.Map
+
+	replaced sync.Map
+	/* 键：字符串类型，已被更换的旧SessionID
+	 * 值：gin.H 类型，新SessionID(id)，宽限期截止时间(due) */
+
+	valid_time      int64 // Session有效时间（秒）
+	rotate_interval int64 // 定期更换SessionID的间隔（秒）
+	rotate_grace    int64 // 更换后旧SessionID仍然有效的宽限期（秒），避免同时发出的请求被登出
+}
+
+func New_session_base(valid_time int64, rotate_interval int64, rotate_grace int64) *Session_base {
+	return &Session_base{
+		valid_time:      valid_time,
+		rotate_interval: rotate_interval,
+		rotate_grace:    rotate_grace,
+	}
+}
+
+func (sb *Session_base) load(id string) (string, gin.H, bool) {
+	// 查找未过期的Session，返回当前有效的SessionID；已更换的旧SessionID在宽限期内指向新的SessionID
+	if value, ok := sb.m.Load(id); ok {
+		info := value.(gin.H)
+		return id, info, time.Now().Unix() <= info["due"].(int64)
+	}
+	if value, ok := sb.replaced.Load(id); ok {
+		if r := value.(gin.H); time.Now().Unix() <= r["due"].(int64) {
+			return sb.load(r["id"].(string))
+		}
+		sb.replaced.Delete(id)
+	}
+	return "", nil, false
+}
+func (sb *Session_base) replace(id string, info gin.H) string {
+	// 更换SessionID，需在加锁后调用
+	now := time.Now().Unix()
+	sb.replaced.Range(func(key, value any) bool {
+		if now > value.(gin.H)["due"].(int64) {
+			sb.replaced.Delete(key)
+		}
+		return true
+	})
+	newID := sb.New_id()
+	info["rotated"] = now
+	delete(info, "rotate")
+	sb.m.Delete(id)
+	sb.m.Store(newID, info)
+	sb.user2ID.Store(info["userID"], newID)
+	sb.replaced.Store(id, gin.H{
+		"id":  newID,
+		"due": now + sb.rotate_grace,
+	})
+	return newID
+}
+func (sb *Session_base) Start(userID string) string {
+	// 为登录成功的用户生成Session，返回新的SessionID
+	id := sb.New_id()
+	sb.Set(id, gin.H{
+		"userID": userID,
+		"due":    time.Now().Unix() + sb.valid_time,
+	})
+	return id
+}
+func (sb *Session_base) Set(id string, info gin.H) {
+	sb.mu.Lock()
+	defer sb.mu.Unlock()
+	if val, ok := sb.user2ID.Load(info["userID"]); ok {
+		sb.m.Delete(val.(string))
+	}
+	info["rotated"] = time.Now().Unix()
+	sb.m.Store(id, info)
+	sb.user2ID.Store(info["userID"], id)
+}
+func (sb *Session_base) Del(id string) {
+	sb.mu.Lock()
+	defer sb.mu.Unlock()
+	if cur, _, ok := sb.load(id); ok {
+		sb.m.Delete(cur)
+	}
+	sb.m.Delete(id)
+}
+func (sb *Session_base) Logout(userID string) {
+	// 使用户当前的登录状态失效
+	sb.mu.Lock()
+	defer sb.mu.Unlock()
+	if val, ok := sb.user2ID.Load(userID); ok {
+		sb.m.Delete(val.(string))
+	}
+}
+func (sb *Session_base) Mark(userID string, key string, value any) {
+	// 修改用户当前Session中的标记
+	sb.mu.Lock()
+	defer sb.mu.Unlock()
+	if val, ok := sb.user2ID.Load(userID); ok {
+		if info, ok := sb.m.Load(val.(string)); ok {
+			info.(gin.H)[key] = value
+		}
+	}
+}
+func (sb *Session_base) Rotate_later(userID string) {
+	// 标记用户当前的Session需更换SessionID，在其下一次请求时更换，用于其他管理员修改了该用户的权限后
+	sb.Mark(userID, "rotate", true)
+}
+func (sb *Session_base) Rotate(userID string) (string, bool) {
+	// 立即更换用户当前的SessionID，用于权限变化后
+	sb.mu.Lock()
+	defer sb.mu.Unlock()
+	val, ok := sb.user2ID.Load(userID)
+	if !ok {
+		return "", false
+	}
+	id, info, ok := sb.load(val.(string))
+	if !ok {
+		return "", false
+	}
+	return sb.replace(id, info), true
+}
+func (sb *Session_base) Touch(id string) (string, gin.H, bool) {
+	// 延长Session有效期，返回当前有效的SessionID和Session数据的副本
+	// 距上次更换超过 rotate_interval 或被标记为需要更换(rotate)时更换SessionID
+	sb.mu.Lock()
+	defer sb.mu.Unlock()
+	cur, info, ok := sb.load(id)
+	if !ok {
+		return "", gin.H{}, false
+	}
+	now := time.Now().Unix()
+	info["due"] = now + sb.valid_time
+	rotated, _ := info["rotated"].(int64)
+	if rotate, _ := info["rotate"].(bool); cur == id && (rotate || now-rotated >= sb.rotate_interval) {
+		cur = sb.replace(id, info)
+	}
+	res := gin.H{}
+	for k, v := range info {
+		res[k] = v
+	}
+	return cur, res, true
+}
+func (sb *Session_base) Get(id string) (gin.H, bool) {
+	sb.mu.Lock()
+	defer sb.mu.Unlock()
+	if _, info, ok := sb.load(id); ok {
+		// 有Session记录，且未过期，返回数据的副本
+		res := gin.H{}
+		for k, v := range info {
+			res[k] = v
+		}
+		return res, true
+	}
+	// 无Session记录或已过期，返回false
+	return gin.H{}, false
+}
+
+func (sb *Session_base) Active() int {
+	// 统计未过期的Session数
+	now := time.Now().Unix()
+	n := 0
+	sb.mu.Lock()
+	defer sb.mu.Unlock()
+	sb.m.Range(func(key, value any) bool {
+		if now <= value.(gin.H)["due"].(int64) {
+			n++
+		}
+		return true
+	})
+	return n
+}
+
+func (sb *Session_base) New_id() string {
+	// SessionID 与其他令牌一样由 crypto/rand 生成，不可预测
+	id := Produce_token()
+	_, exist := sb.m.Load(id)
+	if _, replaced := sb.replaced.Load(id); exist || replaced {
+		// SessionID已存在，重新生成
+		return sb.New_id()
+	}
+	return id
+}
+
+func Produce_token() string {
+	// 密码重置令牌、API令牌等需不可预测，使用 crypto/rand 生成
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,303 @@
+package server
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Storage 保存附件内容，以内容的 SHA-256 摘要（十六进制）为键存取，内容相同的附件共用一份；早期保存、没有摘要记录的附件以附件ID为键
+type Storage interface {
+	Put(ctx context.Context, key string, r io.Reader, size int64, mime string) error
+	Get(ctx context.Context, key string) (io.ReadCloser, error) // 附件不存在时返回的错误满足 errors.Is(err, os.ErrNotExist)
+	Delete(ctx context.Context, key string) error               // 附件不存在时不返回错误
+	// 返回可直接下载附件的临时链接，下载时的 Content-Disposition 和类型由链接指定；不支持时返回空字符串
+	Presign(key string, disposition string, mime string) (string, error)
+	Check(ctx context.Context) error // 检查存储是否可写，供 /readyz 使用
+}
+
+func new_storage(c Config, upload_root string) (Storage, error) {
+	switch c.Storage.Kind {
+	case "s3":
+		endpoint, err := url.Parse(strings.TrimSuffix(c.Storage.Endpoint, "/"))
+		if err != nil {
+			return nil, err
+		}
+		return &s3_storage{
+			endpoint:   endpoint,
+			region:     c.Storage.Region,
+			bucket:     c.Storage.Bucket,
+			access_key: c.Storage.AccessKey,
+			secret_key: c.Storage.SecretKey,
+			presign:    c.Storage.Presign,
+			expire:     time.Duration(c.Storage.PresignExpire) * time.Second,
+			client:     &http.Client{},
+		}, nil
+	default:
+		return &local_storage{dir: upload_root}, nil
+	}
+}
+
+type local_storage struct {
+	dir string // 附件目录，以 / 结尾；附件存放在其下的 files/ 中
+}
+
+func (ls *local_storage) path(key string) string {
+	// 按附件ID前两位分目录
+	return ls.dir + "files/" + key[:2] + "/" + key
+}
+
+func (ls *local_storage) Put(ctx context.Context, key string, r io.Reader, size int64, mime string) error {
+	path := ls.path(key)
+	if err := os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+	if err != nil {
+		return err
+	}
+	if _, err = io.Copy(f, r); err != nil {
+		// 删除写了一半的文件，删除失败时一并返回，以免残留的文件被当作完整的附件
+		f.Close()
+		if rerr := os.Remove(path); rerr != nil && !os.IsNotExist(rerr) {
+			return errors.Join(err, rerr)
+		}
+		return err
+	}
+	return f.Close()
+}
+
+func (ls *local_storage) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	// 返回的 *os.File 支持 Seek，下载时可按 Range 分段返回
+	return os.Open(ls.path(key))
+}
+
+func (ls *local_storage) Delete(ctx context.Context, key string) error {
+	if err := os.Remove(ls.path(key)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+func (ls *local_storage) Presign(key string, disposition string, mime string) (string, error) {
+	return "", nil
+}
+
+func (ls *local_storage) Check(ctx context.Context) error {
+	f, err := os.CreateTemp(ls.dir, ".readyz-*")
+	if err != nil {
+		return err
+	}
+	f.Close()
+	return os.Remove(f.Name())
+}
+
+type s3_storage struct {
+	endpoint   *url.URL // 如 http://localhost:9000，按路径访问存储桶（endpoint/bucket/key），兼容 MinIO
+	region     string
+	bucket     string
+	access_key string
+	secret_key string
+	presign    bool          // 下载时是否重定向到临时链接，否则由服务器转发附件内容
+	expire     time.Duration // 临时链接的有效期
+	client     *http.Client
+}
+
+func (st *s3_storage) url(key string) *url.URL {
+	u := *st.endpoint
+	u.Path = strings.TrimSuffix(u.Path, "/") + "/" + st.bucket
+	if key != "" {
+		u.Path += "/" + key
+	}
+	u.RawPath = ""
+	return &u
+}
+
+func (st *s3_storage) do(ctx context.Context, method string, key string, body io.Reader, size int64, mime string) (*http.Response, error) {
+	// 发送以 AWS Signature Version 4 签名的请求，请求体不参与签名
+	req, err := http.NewRequestWithContext(ctx, method, st.url(key).String(), body)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.ContentLength = size
+		req.Header.Set("Content-Type", mime)
+	}
+	now := time.Now().UTC()
+	req.Header.Set("X-Amz-Date", now.Format("20060102T150405Z"))
+	req.Header.Set("X-Amz-Content-Sha256", "UNSIGNED-PAYLOAD")
+	signed := []string{"host", "x-amz-content-sha256", "x-amz-date"}
+	headers := map[string]string{
+		"host":                 req.URL.Host,
+		"x-amz-content-sha256": "UNSIGNED-PAYLOAD",
+		"x-amz-date":           now.Format("20060102T150405Z"),
+	}
+	signature := st.signature(method, req.URL, headers, "UNSIGNED-PAYLOAD", now)
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s", st.access_key, st.scope(now), strings.Join(signed, ";"), signature))
+	return st.client.Do(req)
+}
+
+func (st *s3_storage) Put(ctx context.Context, key string, r io.Reader, size int64, mime string) error {
+	resp, err := st.do(ctx, http.MethodPut, key, r, size, mime)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("对象存储返回 %s", resp.Status)
+	}
+	return nil
+}
+
+func (st *s3_storage) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	resp, err := st.do(ctx, http.MethodGet, key, nil, 0, "")
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode == http.StatusOK {
+		return resp.Body, nil
+	}
+	resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, fmt.Errorf("对象存储中不存在附件 %s：%w", key, os.ErrNotExist)
+	}
+	return nil, fmt.Errorf("对象存储返回 %s", resp.Status)
+}
+
+func (st *s3_storage) Delete(ctx context.Context, key string) error {
+	resp, err := st.do(ctx, http.MethodDelete, key, nil, 0, "")
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusNoContent && resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusNotFound {
+		return fmt.Errorf("对象存储返回 %s", resp.Status)
+	}
+	return nil
+}
+
+func (st *s3_storage) Presign(key string, disposition string, mime string) (string, error) {
+	if !st.presign {
+		return "", nil
+	}
+	return st.presign_url(key, disposition, mime, time.Now().UTC()), nil
+}
+
+func (st *s3_storage) presign_url(key string, disposition string, mime string, now time.Time) string {
+	// 签名放在查询参数中，并通过 response-content-* 参数指定下载时的文件名和类型
+	u := st.url(key)
+	q := url.Values{}
+	q.Set("X-Amz-Algorithm", "AWS4-HMAC-SHA256")
+	q.Set("X-Amz-Credential", st.access_key+"/"+st.scope(now))
+	q.Set("X-Amz-Date", now.Format("20060102T150405Z"))
+	q.Set("X-Amz-Expires", strconv.FormatInt(int64(st.expire/time.Second), 10))
+	q.Set("X-Amz-SignedHeaders", "host")
+	if disposition != "" {
+		q.Set("response-content-disposition", disposition)
+	}
+	if mime != "" {
+		q.Set("response-content-type", mime)
+	}
+	u.RawQuery = s3_query(q)
+	signature := st.signature(http.MethodGet, u, map[string]string{"host": u.Host}, "UNSIGNED-PAYLOAD", now)
+	u.RawQuery += "&X-Amz-Signature=" + signature
+	return u.String()
+}
+
+func (st *s3_storage) Check(ctx context.Context) error {
+	// 存储桶可访问即视为可用
+	resp, err := st.do(ctx, http.MethodHead, "", nil, 0, "")
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("存储桶 %s 不可访问：%s", st.bucket, resp.Status)
+	}
+	return nil
+}
+
+func (st *s3_storage) scope(now time.Time) string {
+	return now.Format("20060102") + "/" + st.region + "/s3/aws4_request"
+}
+
+func (st *s3_storage) signature(method string, u *url.URL, headers map[string]string, payload string, now time.Time) string {
+	// 按 Signature Version 4 计算签名：规范请求 -> 待签字符串 -> 以派生密钥计算 HMAC
+	names := []string{}
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	canonical_headers := ""
+	for _, name := range names {
+		canonical_headers += name + ":" + strings.TrimSpace(headers[name]) + "\n"
+	}
+	q, _ := url.ParseQuery(u.RawQuery)
+	canonical := strings.Join([]string{
+		method,
+		s3_escape(u.Path, false),
+		s3_query(q),
+		canonical_headers,
+		strings.Join(names, ";"),
+		payload,
+	}, "\n")
+	hash := sha256.Sum256([]byte(canonical))
+	to_sign := strings.Join([]string{
+		"AWS4-HMAC-SHA256",
+		now.Format("20060102T150405Z"),
+		st.scope(now),
+		hex.EncodeToString(hash[:]),
+	}, "\n")
+	key := []byte("AWS4" + st.secret_key)
+	for _, part := range []string{now.Format("20060102"), st.region, "s3", "aws4_request", to_sign} {
+		key = hmac_sha256(key, part)
+	}
+	return hex.EncodeToString(key)
+}
+
+func hmac_sha256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+func s3_escape(s string, encode_slash bool) string {
+	// 除 A-Z a-z 0-9 - _ . ~ 外均按 %XX 编码；路径中的 / 保留，查询参数中的 / 编码
+	var b strings.Builder
+	for _, c := range []byte(s) {
+		if 'A' <= c && c <= 'Z' || 'a' <= c && c <= 'z' || '0' <= c && c <= '9' || c == '-' || c == '_' || c == '.' || c == '~' || c == '/' && !encode_slash {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+func s3_query(q url.Values) string {
+	// 规范查询字符串：按参数名排序，参数名和值均按 s3_escape 编码
+	keys := []string{}
+	for k := range q {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	parts := []string{}
+	for _, k := range keys {
+		for _, v := range q[k] {
+			parts = append(parts, s3_escape(k, true)+"="+s3_escape(v, true))
+		}
+	}
+	return strings.Join(parts, "&")
+}
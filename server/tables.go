@@ -0,0 +1,134 @@
+package server
+
+// 数据表（见 database structure.txt），服务启动时按需创建；新建的数据库（如测试使用的内存数据库）也会创建原有的数据表
+var new_tables = []string{
+	`CREATE TABLE IF NOT EXISTS user(
+		userID TEXT PRIMARY KEY NOT NULL,
+		passwd TEXT NOT NULL,
+		account_type INT NOT NULL,
+		belonging_org INT NOT NULL
+	);`,
+	`CREATE TABLE IF NOT EXISTS organization(
+		orgID INTEGER PRIMARY KEY AUTOINCREMENT,
+		name TEXT NOT NULL,
+		type INT NOT NULL,
+		higher_org INT
+	);`,
+	`CREATE TABLE IF NOT EXISTS appliance(
+		applianceID INTEGER PRIMARY KEY AUTOINCREMENT,
+		itemID INT NOT NULL,
+		userID TEXT NOT NULL,
+		score REAL,
+		status INT,
+		record TEXT,
+		time_unix INT,
+		description TEXT
+	);`,
+	`CREATE TABLE IF NOT EXISTS item(
+		itemID INTEGER PRIMARY KEY AUTOINCREMENT,
+		type INT NOT NULL,
+		status INT,
+		name TEXT NOT NULL,
+		score_lower_range REAL,
+		score_higher_range REAL,
+		create_org INT,
+		description TEXT,
+		time_unix INT,
+		record TEXT
+	);`,
+	`CREATE TABLE IF NOT EXISTS admin_permission(
+		userID TEXT PRIMARY KEY NOT NULL,
+		permissions INT NOT NULL
+	);`,
+	`CREATE TABLE IF NOT EXISTS user_email(
+		userID TEXT PRIMARY KEY NOT NULL,
+		email TEXT NOT NULL
+	);`,
+	`CREATE TABLE IF NOT EXISTS passwd_reset(
+		token TEXT PRIMARY KEY NOT NULL,
+		userID TEXT NOT NULL,
+		due INT NOT NULL,
+		used INT NOT NULL
+	);`,
+	// 删除账号时删除其绑定的邮箱与未使用的密码重置令牌
+	`CREATE TRIGGER IF NOT EXISTS user_email_delete AFTER DELETE ON user BEGIN
+		DELETE FROM user_email WHERE userID=OLD.userID;
+		DELETE FROM passwd_reset WHERE userID=OLD.userID;
+	END;`,
+	`DELETE FROM user_email WHERE userID NOT IN (SELECT userID FROM user);`, // 清理添加触发器之前删除的账号遗留的邮箱
+	`DELETE FROM passwd_reset WHERE userID NOT IN (SELECT userID FROM user);`,
+	`CREATE TABLE IF NOT EXISTS user_totp(
+		userID TEXT PRIMARY KEY NOT NULL,
+		secret TEXT NOT NULL,
+		enabled INT NOT NULL,
+		recovery TEXT NOT NULL,
+		last_step INT NOT NULL
+	);`,
+	// 删除账号时删除其两步验证密钥，以同一用户名重新创建的账号不会沿用
+	`CREATE TRIGGER IF NOT EXISTS user_totp_delete AFTER DELETE ON user BEGIN
+		DELETE FROM user_totp WHERE userID=OLD.userID;
+	END;`,
+	`DELETE FROM user_totp WHERE userID NOT IN (SELECT userID FROM user);`, // 清理添加触发器之前删除的账号遗留的密钥
+	`CREATE TABLE IF NOT EXISTS api_token(
+		tokenID INTEGER PRIMARY KEY AUTOINCREMENT,
+		userID TEXT NOT NULL,
+		name TEXT NOT NULL,
+		hash TEXT UNIQUE NOT NULL,
+		scopes TEXT NOT NULL,
+		created INT NOT NULL,
+		due INT NOT NULL,
+		revoked INT NOT NULL,
+		last_used INT NOT NULL
+	);`,
+	// 修改、重置密码或删除账号时撤销该用户的全部API令牌
+	`CREATE TRIGGER IF NOT EXISTS api_token_revoke_passwd AFTER UPDATE OF passwd ON user BEGIN
+		UPDATE api_token SET revoked=CAST(strftime('%s','now') AS INT) WHERE userID=OLD.userID AND revoked=0;
+	END;`,
+	`CREATE TRIGGER IF NOT EXISTS api_token_revoke_delete AFTER DELETE ON user BEGIN
+		UPDATE api_token SET revoked=CAST(strftime('%s','now') AS INT) WHERE userID=OLD.userID AND revoked=0;
+	END;`,
+	`CREATE TABLE IF NOT EXISTS api_token_log(
+		logID INTEGER PRIMARY KEY AUTOINCREMENT,
+		tokenID INT NOT NULL,
+		time INT NOT NULL,
+		method TEXT NOT NULL,
+		path TEXT NOT NULL,
+		ip TEXT NOT NULL,
+		status INT NOT NULL
+	);`,
+	`CREATE TABLE IF NOT EXISTS item_closed(
+		itemID INTEGER PRIMARY KEY NOT NULL,
+		userID TEXT NOT NULL,
+		time_unix INT NOT NULL
+	);`,
+	`CREATE TABLE IF NOT EXISTS attachment(
+		attachmentID TEXT PRIMARY KEY NOT NULL,
+		owner_type TEXT NOT NULL,
+		ownerID INT NOT NULL,
+		name TEXT NOT NULL,
+		mime TEXT NOT NULL,
+		size INT NOT NULL,
+		uploader TEXT NOT NULL,
+		time_unix INT NOT NULL
+	);`,
+	`CREATE INDEX IF NOT EXISTS attachment_owner ON attachment(owner_type,ownerID);`,
+	`CREATE TABLE IF NOT EXISTS attachment_content(
+		attachmentID TEXT PRIMARY KEY NOT NULL,
+		hash TEXT NOT NULL
+	);`,
+	`CREATE INDEX IF NOT EXISTS attachment_content_hash ON attachment_content(hash);`,
+	`CREATE TABLE IF NOT EXISTS quarantine(
+		attachmentID TEXT PRIMARY KEY NOT NULL,
+		threat TEXT NOT NULL,
+		time_unix INT NOT NULL
+	);`,
+}
+
+func (s *Server) create_tables() error {
+	for _, sql := range new_tables {
+		if _, err := s.DB.Exec(sql); err != nil {
+			return err
+		}
+	}
+	return nil
+}